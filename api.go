@@ -1,15 +1,63 @@
 package jmespath
 
 import (
-	"fmt"
+	"errors"
 	"strconv"
+	"time"
 )
 
+var errNoExpression = errors.New("not expression set")
+
 // JMESPath is the representation of a compiled JMES path query. A JMESPath is
 // safe for concurrent use by multiple goroutines.
 type JMESPath struct {
-	ast  *ASTNode
-	intr *treeInterpreter
+	ast        *ASTNode
+	expression string
+	intr       *treeInterpreter
+}
+
+// Options control how a JMESPath evaluates expressions.  The zero value
+// gives the behavior described by the JMESPath specification.
+type Options struct {
+	// SortKeys makes keys(), values() and object projections such as
+	// "foo.*" visit the keys of a map[string]interface{} in sorted order
+	// instead of Go's random map iteration order, so that results are
+	// deterministic.  Objects given as *OrderedMap are always visited in
+	// insertion order.
+	SortKeys bool
+	// PreserveOrder makes multi-select hashes, merge() and JSON literals
+	// produce *OrderedMap values instead of map[string]interface{}, so
+	// that objects built by an expression keep the key order written in
+	// the expression when they are marshalled.
+	PreserveOrder bool
+	// Clock returns the current time for now().  It defaults to
+	// time.Now, and can be replaced to make expressions that depend on
+	// the current time reproducible, for instance in tests.
+	Clock func() time.Time
+	// Collation controls how strings are ordered when sorting and by
+	// min(), max() and the functions like them.
+	Collation Collation
+	// StringComparisons lets the <, <=, > and >= comparators compare
+	// strings, as the JMESPath community edition does, instead of
+	// returning null for anything but numbers.  Strings are ordered
+	// according to Collation, which by default orders them by code point,
+	// so timestamps in ISO 8601 form such as "2024-01-01T00:00:00Z" are
+	// ordered chronologically.
+	StringComparisons bool
+	// Strict makes evaluation fail with an EvaluationError, which points
+	// at the part of the expression that failed, where JMESPath would
+	// otherwise quietly return null: fields, indexes, slices, flattens
+	// and projections applied to a value of the wrong type, comparisons
+	// of values that aren't numbers and errors in the left hand side of a
+	// filter, flatten or object projection.  A null value still gives
+	// null when a field, index or projection is applied to it or when it
+	// is compared with <, <=, > or >=, so that a missing key isn't an
+	// error.
+	Strict bool
+	// Tracer, if set, is notified as each part of an expression is
+	// evaluated.  NewTreeTracer returns a Tracer that renders the
+	// evaluation as a tree showing every intermediate value.
+	Tracer Tracer
 }
 
 func NewJMESPath( ) *JMESPath {
@@ -25,9 +73,17 @@ func (jp *JMESPath) SetExpression(expression string) error {
 		return err
 	}
 	jp.ast = &ast
+	jp.expression = expression
+	jp.intr.regexps = precompileRegexps(ast, nil)
+	jp.intr.paths = precompilePaths(ast, nil)
 	return nil
 }
 
+// SetOptions replaces the options used when evaluating expressions.
+func (jp *JMESPath) SetOptions(opts Options) {
+	jp.intr.opts = opts
+}
+
 func (jp *JMESPath) AddCustomFunction(custom FunctionEntry) error {
 	return jp.intr.fCall.AddCustomFunction(custom)
 }
@@ -39,15 +95,17 @@ func (jp *JMESPath) SearchWithExpression(expression string, data interface{}) (i
 	if err != nil {
 		return nil, err
 	}
-	return jp.intr.Execute(ast, data)
+	result, err := jp.intr.Execute(ast, data)
+	return result, withExpression(err, expression)
 }
 
 // Search evaluates a JMESPath expression against input data and returns the result.
 func (jp *JMESPath) Search(data interface{}) (interface{}, error) {
 	if jp.ast == nil {
-		return nil, fmt.Errorf("not expression set")
+		return nil, errNoExpression
 	}
-	return jp.intr.Execute(*jp.ast, data)
+	result, err := jp.intr.Execute(*jp.ast, data)
+	return result, withExpression(err, jp.expression)
 }
 
 // Compile parses a JMESPath expression and returns, if successful, a JMESPath
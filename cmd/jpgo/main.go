@@ -10,6 +10,20 @@ Evaluate the JMESPath expression against JSON data from a file:
 
     jp.go -input /tmp/data.json "foo.bar.baz"
 
+Keep the key order of the input and of multi-select hashes in the output:
+
+    jp.go -ordered -input /tmp/data.json "{name: name, id: id}"
+
+Fail instead of returning null when part of the expression doesn't apply
+to the data, and show where:
+
+    jp.go -strict -input /tmp/data.json "foo.bar.baz"
+
+Show how the result was arrived at, with the value of every part of the
+expression, to find out which step produced null:
+
+    jp.go -explain -input /tmp/data.json "foo[?price > `10`].name"
+
 This program can also be used as an executable to the jp-compliance
 runner (github.com/jmespath/jmespath.test).
 
@@ -39,6 +53,9 @@ func run() int {
 
 	astOnly := flag.Bool("ast", false, "Print the AST for the input expression and exit.")
 	inputFile := flag.String("input", "", "Filename containing JSON data to search. If not provided, data is read from stdin.")
+	ordered := flag.Bool("ordered", false, "Keep the key order of objects in the input and in objects built by the expression.")
+	explain := flag.Bool("explain", false, "Print the evaluation tree, with the value of each sub-expression, to stderr.")
+	strict := flag.Bool("strict", false, "Report an error instead of returning null when part of the expression is applied to a value of the wrong type.")
 
 	flag.Parse()
 	args := flag.Args()
@@ -78,9 +95,33 @@ func run() int {
 		}
 	}
 	var data interface{}
-	json.Unmarshal(inputData, &data)
-	result, err := jmespath.Search(expression, data)
+	if *ordered {
+		data, err = jmespath.UnmarshalOrdered(inputData)
+		if err != nil {
+			return errMsg("Error parsing JSON input: %s", err)
+		}
+	} else {
+		json.Unmarshal(inputData, &data)
+	}
+	jp, err := jmespath.Compile(expression)
+	if err != nil {
+		return errMsg("%s", err)
+	}
+	opts := jmespath.Options{PreserveOrder: *ordered, Strict: *strict}
+	var tracer *jmespath.TreeTracer
+	if *explain {
+		tracer = jmespath.NewTreeTracer()
+		opts.Tracer = tracer
+	}
+	jp.SetOptions(opts)
+	result, err := jp.Search(data)
+	if tracer != nil {
+		fmt.Fprint(os.Stderr, tracer)
+	}
 	if err != nil {
+		if evalError, ok := err.(jmespath.EvaluationError); ok {
+			return errMsg("Error executing expression: %s\n%s\n", evalError, evalError.HighlightLocation())
+		}
 		return errMsg("Error executing expression: %s", err)
 	}
 	toJSON, err := json.MarshalIndent(result, "", "  ")
@@ -0,0 +1,127 @@
+package jmespath
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization is a Unicode normalization form strings can be converted
+// to before they are compared.
+type Normalization int
+
+const (
+	// NoNormalization compares strings as they are.
+	NoNormalization Normalization = iota
+	// NFC composes characters, so that "e" followed by a combining acute
+	// accent equals "é".
+	NFC
+	// NFKC also replaces compatibility characters such as "ﬁ" or "①"
+	// with their plain equivalents.
+	NFKC
+)
+
+// Collation controls how strings are ordered by sort(), sort_by(),
+// reverse_sort_by(), min(), max(), min_by() and max_by().  The zero value
+// orders strings by their bytes, as the JMESPath specification requires.
+type Collation struct {
+	// IgnoreCase compares strings using Unicode case folding, so that
+	// "apple" sorts before "Banana".
+	IgnoreCase bool
+	// Normalization converts strings to a Unicode normalization form
+	// before comparing them.
+	Normalization Normalization
+	// Natural compares runs of digits by their numeric value, so that
+	// "file2" sorts before "file10".
+	Natural bool
+}
+
+// key returns the form of s that is compared: s normalized and case
+// folded as requested.  Keys can be computed once and compared many times
+// with compareKeys.
+func (c Collation) key(s string) string {
+	switch c.Normalization {
+	case NFC:
+		s = norm.NFC.String(s)
+	case NFKC:
+		s = norm.NFKC.String(s)
+	}
+	if c.IgnoreCase {
+		s = cases.Fold().String(s)
+	}
+	return s
+}
+
+// compareKeys compares two keys returned by key.
+func (c Collation) compareKeys(a, b string) int {
+	if !c.Natural {
+		return strings.Compare(a, b)
+	}
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			aDigits, bDigits := digitPrefix(a), digitPrefix(b)
+			if cmp := compareNumeric(aDigits, bDigits); cmp != 0 {
+				return cmp
+			}
+			a, b = a[len(aDigits):], b[len(bDigits):]
+			continue
+		}
+		ra, sizeA := utf8.DecodeRuneInString(a)
+		rb, sizeB := utf8.DecodeRuneInString(b)
+		if ra != rb {
+			if ra < rb {
+				return -1
+			}
+			return 1
+		}
+		a, b = a[sizeA:], b[sizeB:]
+	}
+	return strings.Compare(a, b)
+}
+
+// compare returns -1, 0 or 1 depending on whether a sorts before, the same
+// as or after b.
+func (c Collation) compare(a, b string) int {
+	if c == (Collation{}) {
+		return strings.Compare(a, b)
+	}
+	return c.compareKeys(c.key(a), c.key(b))
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func digitPrefix(s string) string {
+	end := 0
+	for end < len(s) && isDigit(s[end]) {
+		end++
+	}
+	return s[:end]
+}
+
+// compareNumeric compares two strings of digits by their value, without
+// limiting how many digits they have.  Numbers with the same value but
+// a different number of leading zeros order by their length.
+func compareNumeric(a, b string) int {
+	trimmedA := strings.TrimLeft(a, "0")
+	trimmedB := strings.TrimLeft(b, "0")
+	if len(trimmedA) != len(trimmedB) {
+		if len(trimmedA) < len(trimmedB) {
+			return -1
+		}
+		return 1
+	}
+	if cmp := strings.Compare(trimmedA, trimmedB); cmp != 0 {
+		return cmp
+	}
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
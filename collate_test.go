@@ -0,0 +1,92 @@
+package jmespath
+
+import (
+	"testing"
+
+	"github.com/jmespath/go-jmespath/internal/testify/assert"
+)
+
+func TestCollationCompare(t *testing.T) {
+	assert := assert.New(t)
+	cases := []struct {
+		collation Collation
+		a, b      string
+		expected  int
+	}{
+		{Collation{}, "Banana", "apple", -1},
+		{Collation{}, "file10", "file2", -1},
+		{Collation{}, "é", "é", -1},
+		{Collation{IgnoreCase: true}, "Banana", "apple", 1},
+		{Collation{IgnoreCase: true}, "APPLE", "apple", 0},
+		{Collation{IgnoreCase: true}, "STRASSE", "straße", 0},
+		{Collation{Normalization: NFC}, "é", "é", 0},
+		{Collation{Normalization: NFC}, "ﬁle", "file", 1},
+		{Collation{Normalization: NFKC}, "ﬁle", "file", 0},
+		{Collation{Natural: true}, "file10", "file2", 1},
+		{Collation{Natural: true}, "file2", "file10", -1},
+		{Collation{Natural: true}, "file02", "file2", 1},
+		{Collation{Natural: true}, "v1.10.1", "v1.9.12", 1},
+		{Collation{Natural: true}, "a", "a1", -1},
+		{Collation{Natural: true}, "12345678901234567890123", "9", 1},
+		{Collation{Natural: true, IgnoreCase: true}, "File10", "file9", 1},
+	}
+	for _, tt := range cases {
+		assert.Equal(tt.expected, tt.collation.compare(tt.a, tt.b), "%+v: %q <=> %q", tt.collation, tt.a, tt.b)
+		assert.Equal(-tt.expected, tt.collation.compare(tt.b, tt.a), "%+v: %q <=> %q", tt.collation, tt.b, tt.a)
+	}
+}
+
+func TestCollationOption(t *testing.T) {
+	assert := assert.New(t)
+	data := map[string]interface{}{
+		"names": []interface{}{"bob", "Alice", "carol", "alice", "Bob"},
+		"files": []interface{}{
+			map[string]interface{}{"name": "img10.png"},
+			map[string]interface{}{"name": "IMG2.png"},
+			map[string]interface{}{"name": "img1.png"},
+		},
+	}
+	cases := []struct {
+		expression string
+		collation  Collation
+		expected   interface{}
+	}{
+		{"sort(names)", Collation{}, []interface{}{"Alice", "Bob", "alice", "bob", "carol"}},
+		{"sort(names)", Collation{IgnoreCase: true}, []interface{}{"Alice", "alice", "bob", "Bob", "carol"}},
+		{"max(names)", Collation{}, "carol"},
+		{"min(names)", Collation{}, "Alice"},
+		{"min(names)", Collation{IgnoreCase: true}, "Alice"},
+		{"sort_by(files, &name)[*].name", Collation{}, []interface{}{"IMG2.png", "img1.png", "img10.png"}},
+		{"sort_by(files, &name)[*].name", Collation{IgnoreCase: true, Natural: true}, []interface{}{"img1.png", "IMG2.png", "img10.png"}},
+		{"reverse_sort_by(files, &name)[*].name", Collation{IgnoreCase: true, Natural: true}, []interface{}{"img10.png", "IMG2.png", "img1.png"}},
+		{"max_by(files, &name).name", Collation{IgnoreCase: true, Natural: true}, "img10.png"},
+		{"min_by(files, &name).name", Collation{}, "IMG2.png"},
+		{"sort_ci(names)", Collation{}, []interface{}{"Alice", "alice", "bob", "Bob", "carol"}},
+	}
+	for _, tt := range cases {
+		jp, err := Compile(tt.expression)
+		assert.Nil(err)
+		jp.SetOptions(Options{Collation: tt.collation})
+		result, err := jp.Search(data)
+		if assert.Nil(err, tt.expression) {
+			assert.Equal(tt.expected, result, "%s with %+v", tt.expression, tt.collation)
+		}
+	}
+}
+
+func TestExportedMinMaxAndSort(t *testing.T) {
+	assert := assert.New(t)
+	names := []interface{}{"bob", "Alice", "carol"}
+	result, err := JPfMax([]interface{}{names})
+	assert.Nil(err)
+	assert.Equal("carol", result)
+	result, err = JPfMin([]interface{}{names})
+	assert.Nil(err)
+	assert.Equal("Alice", result)
+	result, err = JPfSort([]interface{}{names})
+	assert.Nil(err)
+	assert.Equal([]interface{}{"Alice", "bob", "carol"}, result)
+	result, err = JPfSort([]interface{}{[]interface{}{2.0, 1.0}})
+	assert.Nil(err)
+	assert.Equal([]interface{}{1.0, 2.0}, result)
+}
@@ -0,0 +1,318 @@
+package jmespath
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// DecodeError is returned by SearchInto when the result of a search cannot
+// be converted into the Go value supplied by the caller.
+type DecodeError struct {
+	Path  string       // Location in the search result, e.g. "@.items[2].id"
+	Value interface{}  // The value that could not be converted
+	Type  reflect.Type // The Go type the value was being converted to
+}
+
+func (e DecodeError) Error() string {
+	return fmt.Sprintf("jmespath: cannot decode %s into Go value of type %s at %s",
+		describeValue(e.Value), e.Type, e.Path)
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// SearchInto evaluates the compiled expression against data and stores the
+// result in the value pointed to by out.  Numbers are converted to any Go
+// numeric type as long as they fit, arrays to slices and arrays, and objects
+// to maps with string keys or to structs, whose fields are matched using
+// their json tags in the same way encoding/json matches them.
+func (jp *JMESPath) SearchInto(data interface{}, out interface{}) error {
+	result, err := jp.Search(data)
+	if err != nil {
+		return err
+	}
+	return decodeResult(result, out)
+}
+
+// SearchInto evaluates a JMESPath expression against input data and stores
+// the result in the value pointed to by out.
+func SearchInto(expression string, data interface{}, out interface{}) error {
+	result, err := Search(expression, data)
+	if err != nil {
+		return err
+	}
+	return decodeResult(result, out)
+}
+
+func decodeResult(result interface{}, out interface{}) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("jmespath: SearchInto requires a non-nil pointer")
+	}
+	return decodeValue("@", result, rv.Elem())
+}
+
+func decodeValue(path string, value interface{}, rv reflect.Value) error {
+	if value == nil {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+	if reflect.TypeOf(value).AssignableTo(rv.Type()) {
+		rv.Set(reflect.ValueOf(value))
+		return nil
+	}
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return decodeValue(path, value, rv.Elem())
+	}
+	if reflect.PtrTo(rv.Type()).Implements(jsonUnmarshalerType) {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if err := rv.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(encoded); err != nil {
+			return fmt.Errorf("jmespath: cannot decode value at %s: %s", path, err)
+		}
+		return nil
+	}
+	mismatch := DecodeError{Path: path, Value: value, Type: rv.Type()}
+	switch rv.Kind() {
+	case reflect.Interface:
+		if rv.NumMethod() == 0 {
+			rv.Set(reflect.ValueOf(value))
+			return nil
+		}
+	case reflect.Bool:
+		if b, ok := value.(bool); ok {
+			rv.SetBool(b)
+			return nil
+		}
+	case reflect.String:
+		if s, ok := value.(string); ok {
+			rv.SetString(s)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f, ok := toFloat(value); ok && f == math.Trunc(f) {
+			n := int64(f)
+			if float64(n) == f && !rv.OverflowInt(n) {
+				rv.SetInt(n)
+				return nil
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if f, ok := toFloat(value); ok && f >= 0 && f == math.Trunc(f) {
+			n := uint64(f)
+			if float64(n) == f && !rv.OverflowUint(n) {
+				rv.SetUint(n)
+				return nil
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, ok := toFloat(value); ok && !rv.OverflowFloat(f) {
+			rv.SetFloat(f)
+			return nil
+		}
+	case reflect.Slice:
+		if isSliceType(value) {
+			v := reflect.ValueOf(value)
+			decoded := reflect.MakeSlice(rv.Type(), v.Len(), v.Len())
+			for i := 0; i < v.Len(); i++ {
+				elemPath := path + "[" + strconv.Itoa(i) + "]"
+				if err := decodeValue(elemPath, v.Index(i).Interface(), decoded.Index(i)); err != nil {
+					return err
+				}
+			}
+			rv.Set(decoded)
+			return nil
+		}
+	case reflect.Array:
+		if isSliceType(value) {
+			v := reflect.ValueOf(value)
+			for i := 0; i < rv.Len(); i++ {
+				if i >= v.Len() {
+					rv.Index(i).Set(reflect.Zero(rv.Type().Elem()))
+					continue
+				}
+				elemPath := path + "[" + strconv.Itoa(i) + "]"
+				if err := decodeValue(elemPath, v.Index(i).Interface(), rv.Index(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if isObject(value) {
+			decoded := reflect.MakeMapWithSize(rv.Type(), objectLen(value))
+			for _, key := range objectKeys(value, false) {
+				item := objectGet(value, key)
+				elem := reflect.New(rv.Type().Elem()).Elem()
+				if err := decodeValue(path+fieldPath(key), item, elem); err != nil {
+					return err
+				}
+				decoded.SetMapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()), elem)
+			}
+			rv.Set(decoded)
+			return nil
+		}
+	case reflect.Struct:
+		if isObject(value) {
+			fields := structFields(rv.Type())
+			for _, key := range objectKeys(value, false) {
+				item := objectGet(value, key)
+				index, ok := matchField(fields, key)
+				if !ok {
+					continue
+				}
+				if err := decodeValue(path+fieldPath(key), item, fieldByIndex(rv, index)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return mismatch
+}
+
+// toFloat converts the numeric types that can appear in search results,
+// including numbers taken from user defined structs, to a float64.
+func toFloat(value interface{}) (float64, bool) {
+	if f, ok := value.(float64); ok {
+		return f, true
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+type decodeField struct {
+	name  string
+	index []int
+}
+
+// structFields returns the fields of t that can be decoded into, named the
+// way encoding/json would name them.  Fields of embedded structs without a
+// json tag are promoted into the parent.
+func structFields(t reflect.Type) []decodeField {
+	var fields []decodeField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for _, promoted := range structFields(ft) {
+					promoted.index = append([]int{i}, promoted.index...)
+					fields = append(fields, promoted)
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			// Unexported field.
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, decodeField{name: name, index: []int{i}})
+	}
+	return fields
+}
+
+// matchField finds the field for key, preferring an exact match over a
+// case-insensitive one.
+func matchField(fields []decodeField, key string) ([]int, bool) {
+	for _, f := range fields {
+		if f.name == key {
+			return f.index, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, key) {
+			return f.index, true
+		}
+	}
+	return nil, false
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex but allocates nil
+// embedded struct pointers along the way.
+func fieldByIndex(rv reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv
+}
+
+// fieldPath renders key as a JMESPath sub-expression so that decode error
+// paths can be pasted back into an expression.
+func fieldPath(key string) string {
+	if isIdentifier(key) {
+		return "." + key
+	}
+	return "." + strconv.Quote(key)
+}
+
+func isIdentifier(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, r := range key {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			continue
+		}
+		if i > 0 && r >= '0' && r <= '9' {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func describeValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number " + strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}, *OrderedMap:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
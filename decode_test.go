@@ -0,0 +1,125 @@
+package jmespath
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jmespath/go-jmespath/internal/testify/assert"
+)
+
+type decodeInstance struct {
+	ID    string   `json:"id"`
+	Cores int      `json:"cores"`
+	Tags  []string `json:"tags,omitempty"`
+	Zone  *string
+	Extra bool `json:"-"`
+}
+
+type decodeReservation struct {
+	Instances []decodeInstance `json:"instances"`
+	Count     uint8
+}
+
+func decodeFixture(t *testing.T) interface{} {
+	var data interface{}
+	err := json.Unmarshal([]byte(`{
+		"reservations": [
+			{"count": 2, "instances": [
+				{"id": "i-1", "cores": 4, "tags": ["a"], "zone": "us-east-1a", "Extra": true},
+				{"id": "i-2", "cores": 8}
+			]}
+		]
+	}`), &data)
+	assert.Nil(t, err)
+	return data
+}
+
+func TestSearchIntoScalars(t *testing.T) {
+	assert := assert.New(t)
+	data := decodeFixture(t)
+	var cores []int
+	err := SearchInto("reservations[].instances[].cores", data, &cores)
+	assert.Nil(err)
+	assert.Equal([]int{4, 8}, cores)
+
+	var id string
+	err = SearchInto("reservations[0].instances[1].id", data, &id)
+	assert.Nil(err)
+	assert.Equal("i-2", id)
+}
+
+func TestSearchIntoStructs(t *testing.T) {
+	assert := assert.New(t)
+	data := decodeFixture(t)
+	var reservation decodeReservation
+	err := SearchInto("reservations[0]", data, &reservation)
+	assert.Nil(err)
+	assert.Equal(uint8(2), reservation.Count)
+	assert.Len(reservation.Instances, 2)
+	first := reservation.Instances[0]
+	assert.Equal("i-1", first.ID)
+	assert.Equal(4, first.Cores)
+	assert.Equal([]string{"a"}, first.Tags)
+	if assert.NotNil(first.Zone) {
+		assert.Equal("us-east-1a", *first.Zone)
+	}
+	assert.False(first.Extra)
+	assert.Nil(reservation.Instances[1].Zone)
+}
+
+func TestSearchIntoPointersAndMaps(t *testing.T) {
+	assert := assert.New(t)
+	data := decodeFixture(t)
+	var byID map[string]*int
+	err := SearchInto("{first: reservations[0].instances[0].cores, missing: nope}", data, &byID)
+	assert.Nil(err)
+	if assert.NotNil(byID["first"]) {
+		assert.Equal(4, *byID["first"])
+	}
+	assert.Nil(byID["missing"])
+}
+
+func TestSearchIntoPrecompiled(t *testing.T) {
+	assert := assert.New(t)
+	jp := MustCompile("reservations[0].instances[*].id")
+	var ids [3]string
+	err := jp.SearchInto(decodeFixture(t), &ids)
+	assert.Nil(err)
+	assert.Equal([3]string{"i-1", "i-2", ""}, ids)
+}
+
+func TestSearchIntoReportsPath(t *testing.T) {
+	assert := assert.New(t)
+	data := decodeFixture(t)
+	var instances []struct {
+		ID    int `json:"id"`
+		Cores int `json:"cores"`
+	}
+	err := SearchInto("reservations[0].instances", data, &instances)
+	if assert.NotNil(err) {
+		decodeErr, ok := err.(DecodeError)
+		assert.True(ok)
+		assert.Equal("@[0].id", decodeErr.Path)
+		assert.Contains(err.Error(), "@[0].id")
+	}
+}
+
+func TestSearchIntoRejectsLossyNumbers(t *testing.T) {
+	assert := assert.New(t)
+	var small int8
+	err := SearchInto("`300`", nil, &small)
+	assert.NotNil(err)
+	var whole int
+	err = SearchInto("`1.5`", nil, &whole)
+	assert.NotNil(err)
+	var unsigned uint
+	err = SearchInto("`-1`", nil, &unsigned)
+	assert.NotNil(err)
+}
+
+func TestSearchIntoRequiresPointer(t *testing.T) {
+	assert := assert.New(t)
+	var out string
+	err := SearchInto("foo", nil, out)
+	assert.NotNil(err)
+}
@@ -1,15 +1,27 @@
 package jmespath
 
 import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"math"
+	"net"
+	"net/url"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 type JPFunction func(arguments []interface{}) (interface{}, error)
@@ -33,89 +45,149 @@ type FunctionEntry struct {
 	arguments []ArgSpec
 	handler   JPFunction
 	hasExpRef bool
+	needsIntr bool
 }
 
 type ArgSpec struct {
 	types    []JPType
 	variadic bool
+	optional bool
 }
 
-type byExprString struct {
-	intr     *treeInterpreter
-	node     ASTNode
-	items    []interface{}
-	hasError bool
+// byKeys holds the keys sort_by and reverse_sort_by order an array by,
+// evaluated once for each element.  keys[i][k] is the k-th key of the
+// i-th element.
+type byKeys struct {
+	keys       [][]interface{}
+	descending bool
+	collation  Collation
 }
 
-func (a *byExprString) Len() int {
-	return len(a.items)
-}
-func (a *byExprString) Swap(i, j int) {
-	a.items[i], a.items[j] = a.items[j], a.items[i]
-}
-func (a *byExprString) Less(i, j int) bool {
-	first, err := a.intr.Execute(a.node, a.items[i])
-	if err != nil {
-		a.hasError = true
-		// Return a dummy value.
-		return true
-	}
-	ith, ok := first.(string)
-	if !ok {
-		a.hasError = true
-		return true
+// newByKeys evaluates every key expression against every element of arr.
+// The values of the first key must either all be numbers or all be
+// strings: the specification requires sort_by() to fail otherwise, and
+// the compliance tests check that it does for a missing field and for a
+// mix of numbers and strings.  Tie-breaking keys aren't covered by the
+// specification and are ordered totally instead: they can mix numbers,
+// which sort before strings, with strings and with nulls, for example
+// because a field is missing, and nulls sort after every other value
+// whether the sort is ascending or descending.
+func newByKeys(intr *treeInterpreter, arr []interface{}, exprs []interface{}) (*byKeys, error) {
+	keys := make([][]interface{}, len(arr))
+	for i, item := range arr {
+		keys[i] = make([]interface{}, len(exprs))
+		for k, expr := range exprs {
+			key, err := intr.Execute(expr.(expRef).ref, item)
+			if err != nil {
+				return nil, err
+			}
+			keys[i][k] = sortKey(key)
+		}
 	}
-	second, err := a.intr.Execute(a.node, a.items[j])
-	if err != nil {
-		a.hasError = true
-		// Return a dummy value.
-		return true
+	for k := range exprs {
+		var keyType string
+		for i := range keys {
+			var t string
+			switch keys[i][k].(type) {
+			case float64:
+				t = "number"
+			case string:
+				t = "string"
+			case nil:
+				if k > 0 {
+					continue
+				}
+				t = "null"
+			default:
+				t, _ = jpTypeOf(keys[i][k])
+			}
+			if t != "number" && t != "string" {
+				return nil, fmt.Errorf("invalid type, sort key must be a number or a string, got %s", t)
+			}
+			if k == 0 && keyType != "" && t != keyType {
+				return nil, errors.New("invalid type, sort keys must all be numbers or all be strings")
+			}
+			keyType = t
+		}
 	}
-	jth, ok := second.(string)
-	if !ok {
-		a.hasError = true
-		return true
+	// String keys are compared in their collated form.
+	collation := intr.opts.Collation
+	for i := range keys {
+		for k, key := range keys[i] {
+			if str, ok := key.(string); ok {
+				keys[i][k] = collation.key(str)
+			}
+		}
 	}
-	return ith < jth
-}
-
-type byExprFloat struct {
-	intr     *treeInterpreter
-	node     ASTNode
-	items    []interface{}
-	hasError bool
+	return &byKeys{keys: keys, collation: collation}, nil
 }
 
-func (a *byExprFloat) Len() int {
-	return len(a.items)
-}
-func (a *byExprFloat) Swap(i, j int) {
-	a.items[i], a.items[j] = a.items[j], a.items[i]
-}
-func (a *byExprFloat) Less(i, j int) bool {
-	first, err := a.intr.Execute(a.node, a.items[i])
-	if err != nil {
-		a.hasError = true
-		// Return a dummy value.
-		return true
+// sortKey converts the numbers and strings of user defined structs, such
+// as an int field, to the float64 and string values compare orders.
+func sortKey(key interface{}) interface{} {
+	if f, ok := toFloat(key); ok {
+		return f
 	}
-	ith, ok := first.(float64)
-	if !ok {
-		a.hasError = true
-		return true
-	}
-	second, err := a.intr.Execute(a.node, a.items[j])
-	if err != nil {
-		a.hasError = true
-		// Return a dummy value.
-		return true
+	if rv := reflect.ValueOf(key); rv.Kind() == reflect.String {
+		return rv.String()
 	}
-	jth, ok := second.(float64)
-	if !ok {
-		a.hasError = true
-		return true
+	return key
+}
+
+// compare compares the keys of the i-th and j-th elements.
+func (s *byKeys) compare(i, j int) int {
+	for k := range s.keys[i] {
+		left, right := s.keys[i][k], s.keys[j][k]
+		if left == nil || right == nil {
+			if left == nil && right != nil {
+				return 1
+			} else if left != nil && right == nil {
+				return -1
+			}
+			continue
+		}
+		c := 0
+		switch l := left.(type) {
+		case float64:
+			if r, ok := right.(float64); !ok {
+				c = -1
+			} else if l < r {
+				c = -1
+			} else if l > r {
+				c = 1
+			}
+		case string:
+			if r, ok := right.(string); ok {
+				c = s.collation.compareKeys(l, r)
+			} else {
+				c = 1
+			}
+		}
+		if s.descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
 	}
-	return ith < jth
+	return 0
+}
+
+// sort returns a sorted copy of arr, keeping equal elements in their
+// original order.
+func (s *byKeys) sort(arr []interface{}) []interface{} {
+	order := make([]int, len(arr))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return s.compare(order[a], order[b]) < 0
+	})
+	sorted := make([]interface{}, len(arr))
+	for i, index := range order {
+		sorted[i] = arr[index]
+	}
+	return sorted
 }
 
 type functionCaller struct {
@@ -184,6 +256,90 @@ func newFunctionCaller() *functionCaller {
 			},
 			handler: JPfFloor,
 		},
+		"round": {
+			name: "round",
+			arguments: []ArgSpec{
+				{types: []JPType{JPNumber}},
+				{types: []JPType{JPNumber}, optional: true},
+			},
+			handler: JPfRound,
+		},
+		"pow": {
+			name: "pow",
+			arguments: []ArgSpec{
+				{types: []JPType{JPNumber}},
+				{types: []JPType{JPNumber}},
+			},
+			handler: JPfPow,
+		},
+		"sqrt": {
+			name: "sqrt",
+			arguments: []ArgSpec{
+				{types: []JPType{JPNumber}},
+			},
+			handler: JPfSqrt,
+		},
+		"log": {
+			name: "log",
+			arguments: []ArgSpec{
+				{types: []JPType{JPNumber}},
+				{types: []JPType{JPNumber}, optional: true},
+			},
+			handler: JPfLog,
+		},
+		"exp": {
+			name: "exp",
+			arguments: []ArgSpec{
+				{types: []JPType{JPNumber}},
+			},
+			handler: JPfExp,
+		},
+		"mod": {
+			name: "mod",
+			arguments: []ArgSpec{
+				{types: []JPType{JPNumber}},
+				{types: []JPType{JPNumber}},
+			},
+			handler: JPfMod,
+		},
+		"clamp": {
+			name: "clamp",
+			arguments: []ArgSpec{
+				{types: []JPType{JPNumber}},
+				{types: []JPType{JPNumber}},
+				{types: []JPType{JPNumber}},
+			},
+			handler: JPfClamp,
+		},
+		"median": {
+			name: "median",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArrayNumber}},
+			},
+			handler: JPfMedian,
+		},
+		"stddev": {
+			name: "stddev",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArrayNumber}},
+			},
+			handler: JPfStddev,
+		},
+		"percentile": {
+			name: "percentile",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArrayNumber}},
+				{types: []JPType{JPNumber}},
+			},
+			handler: JPfPercentile,
+		},
+		"product": {
+			name: "product",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArrayNumber}},
+			},
+			handler: JPfProduct,
+		},
 		"map": {
 			name: "amp",
 			arguments: []ArgSpec{
@@ -193,19 +349,85 @@ func newFunctionCaller() *functionCaller {
 			handler:   JPfMap,
 			hasExpRef: true,
 		},
+		"filter": {
+			name: "filter",
+			arguments: []ArgSpec{
+				{types: []JPType{JPExpref}},
+				{types: []JPType{JPArray}},
+			},
+			handler:   JPfFilter,
+			hasExpRef: true,
+		},
+		"reduce": {
+			name: "reduce",
+			arguments: []ArgSpec{
+				{types: []JPType{JPExpref}},
+				{types: []JPType{JPArray}},
+				{types: []JPType{JPAny}},
+			},
+			handler:   JPfReduce,
+			hasExpRef: true,
+		},
+		"any": {
+			name: "any",
+			arguments: []ArgSpec{
+				{types: []JPType{JPExpref}},
+				{types: []JPType{JPArray}},
+			},
+			handler:   JPfAny,
+			hasExpRef: true,
+		},
+		"all": {
+			name: "all",
+			arguments: []ArgSpec{
+				{types: []JPType{JPExpref}},
+				{types: []JPType{JPArray}},
+			},
+			handler:   JPfAll,
+			hasExpRef: true,
+		},
+		"find": {
+			name: "find",
+			arguments: []ArgSpec{
+				{types: []JPType{JPExpref}},
+				{types: []JPType{JPArray}},
+			},
+			handler:   JPfFind,
+			hasExpRef: true,
+		},
+		"find_index": {
+			name: "find_index",
+			arguments: []ArgSpec{
+				{types: []JPType{JPExpref}},
+				{types: []JPType{JPArray}},
+			},
+			handler:   JPfFindIndex,
+			hasExpRef: true,
+		},
+		"flat_map": {
+			name: "flat_map",
+			arguments: []ArgSpec{
+				{types: []JPType{JPExpref}},
+				{types: []JPType{JPArray}},
+			},
+			handler:   JPfFlatMap,
+			hasExpRef: true,
+		},
 		"max": {
 			name: "max",
 			arguments: []ArgSpec{
 				{types: []JPType{JPArrayNumber, JPArrayString}},
 			},
-			handler: JPfMax,
+			handler:   jpfMax,
+			needsIntr: true,
 		},
 		"merge": {
 			name: "merge",
 			arguments: []ArgSpec{
 				{types: []JPType{JPObject}, variadic: true},
 			},
-			handler: JPfMerge,
+			handler:   jpfMerge,
+			needsIntr: true,
 		},
 		"max_by": {
 			name: "max_by",
@@ -228,7 +450,8 @@ func newFunctionCaller() *functionCaller {
 			arguments: []ArgSpec{
 				{types: []JPType{JPArrayNumber, JPArrayString}},
 			},
-			handler: JPfMin,
+			handler:   jpfMin,
+			needsIntr: true,
 		},
 		"min_by": {
 			name: "min_by",
@@ -251,31 +474,68 @@ func newFunctionCaller() *functionCaller {
 			arguments: []ArgSpec{
 				{types: []JPType{JPObject}},
 			},
-			handler: JPfKeys,
+			handler:   jpfKeys,
+			needsIntr: true,
 		},
 		"values": {
 			name: "values",
 			arguments: []ArgSpec{
 				{types: []JPType{JPObject}},
 			},
-			handler: JPfValues,
+			handler:   jpfValues,
+			needsIntr: true,
 		},
 		"sort": {
 			name: "sort",
 			arguments: []ArgSpec{
 				{types: []JPType{JPArrayString, JPArrayNumber}},
 			},
-			handler: JPfSort,
+			handler:   jpfSort,
+			needsIntr: true,
 		},
 		"sort_by": {
 			name: "sort_by",
 			arguments: []ArgSpec{
 				{types: []JPType{JPArray}},
-				{types: []JPType{JPExpref}},
+				{types: []JPType{JPExpref}, variadic: true},
 			},
 			handler:   JPfSortBy,
 			hasExpRef: true,
 		},
+		"reverse_sort_by": {
+			name: "reverse_sort_by",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}},
+				{types: []JPType{JPExpref}, variadic: true},
+			},
+			handler:   JPfReverseSortBy,
+			hasExpRef: true,
+		},
+		"sort_ci": {
+			name: "sort_ci",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArrayString}},
+			},
+			handler:   JPfSortCI,
+			needsIntr: true,
+		},
+		"equals_ci": {
+			name: "equals_ci",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+			},
+			handler:   JPfEqualsCI,
+			needsIntr: true,
+		},
+		"normalize": {
+			name: "normalize",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}, optional: true},
+			},
+			handler: JPfNormalize,
+		},
 		"join": {
 			name: "join",
 			arguments: []ArgSpec{
@@ -319,533 +579,2850 @@ func newFunctionCaller() *functionCaller {
 			},
 			handler: JPfNotNull,
 		},
-	}
-	return caller
-}
-
-func (e *FunctionEntry) resolveArgs(arguments []interface{}) ([]interface{}, error) {
-	if len(e.arguments) == 0 {
-		return arguments, nil
-	}
-	if !e.arguments[len(e.arguments)-1].variadic {
-		if len(e.arguments) != len(arguments) {
-			return nil, errors.New("incorrect number of args")
-		}
-		for i, spec := range e.arguments {
-			userArg := arguments[i]
-			err := spec.typeCheck(userArg)
-			if err != nil {
-				return nil, err
-			}
-		}
-		return arguments, nil
-	}
-	if len(arguments) < len(e.arguments) {
-		return nil, errors.New("Invalid arity.")
-	}
-	return arguments, nil
-}
-
-func (a *ArgSpec) typeCheck(arg interface{}) error {
-	for _, t := range a.types {
-		switch t {
-		case JPNumber:
-			if _, ok := arg.(float64); ok {
-				return nil
-			}
-		case JPString:
-			if _, ok := arg.(string); ok {
-				return nil
-			}
-		case JPArray:
-			if isSliceType(arg) {
-				return nil
-			}
-		case JPObject:
-			if _, ok := arg.(map[string]interface{}); ok {
-				return nil
-			}
-		case JPArrayNumber:
-			if _, ok := toArrayNum(arg); ok {
-				return nil
-			}
-		case JPArrayString:
-			if _, ok := toArrayStr(arg); ok {
-				return nil
-			}
-		case JPAny:
-			return nil
-		case JPExpref:
-			if _, ok := arg.(expRef); ok {
-				return nil
-			}
-		}
-	}
-	return fmt.Errorf("Invalid type for: %v, expected: %#v", arg, a.types)
-}
-
-func (f *functionCaller) AddCustomFunction(custom FunctionEntry) error {
-	_, ok := f.functionTable[custom.name]
-	if ok {
-		return fmt.Errorf("function with name %s already defined", custom.name)
-	}
-	f.functionTable[custom.name] = custom
-	return nil
-}
-
-func (f *functionCaller) CallFunction(name string, arguments []interface{}, intr *treeInterpreter) (interface{}, error) {
-	entry, ok := f.functionTable[name]
-	if !ok {
-		return nil, errors.New("unknown function: " + name)
-	}
-	resolvedArgs, err := entry.resolveArgs(arguments)
-	if err != nil {
-		return nil, err
-	}
-	if entry.hasExpRef {
-		var extra []interface{}
-		extra = append(extra, intr)
-		resolvedArgs = append(extra, resolvedArgs...)
-	}
-	return entry.handler(resolvedArgs)
-}
-
-func JPfAbs(arguments []interface{}) (interface{}, error) {
-	num := arguments[0].(float64)
-	return math.Abs(num), nil
-}
-
-func JPfLength(arguments []interface{}) (interface{}, error) {
-	arg := arguments[0]
-	if c, ok := arg.(string); ok {
-		return float64(utf8.RuneCountInString(c)), nil
-	} else if isSliceType(arg) {
-		v := reflect.ValueOf(arg)
-		return float64(v.Len()), nil
-	} else if c, ok := arg.(map[string]interface{}); ok {
-		return float64(len(c)), nil
-	}
-	return nil, errors.New("could not compute length()")
-}
-
+		"is_string": {
+			name: "is_string",
+			arguments: []ArgSpec{
+				{types: []JPType{JPAny}},
+			},
+			handler: JPfIsString,
+		},
+		"is_number": {
+			name: "is_number",
+			arguments: []ArgSpec{
+				{types: []JPType{JPAny}},
+			},
+			handler: JPfIsNumber,
+		},
+		"is_array": {
+			name: "is_array",
+			arguments: []ArgSpec{
+				{types: []JPType{JPAny}},
+			},
+			handler: JPfIsArray,
+		},
+		"is_object": {
+			name: "is_object",
+			arguments: []ArgSpec{
+				{types: []JPType{JPAny}},
+			},
+			handler: JPfIsObject,
+		},
+		"is_boolean": {
+			name: "is_boolean",
+			arguments: []ArgSpec{
+				{types: []JPType{JPAny}},
+			},
+			handler: JPfIsBoolean,
+		},
+		"is_null": {
+			name: "is_null",
+			arguments: []ArgSpec{
+				{types: []JPType{JPAny}},
+			},
+			handler: JPfIsNull,
+		},
+		"to_boolean": {
+			name: "to_boolean",
+			arguments: []ArgSpec{
+				{types: []JPType{JPAny}},
+			},
+			handler: JPfToBoolean,
+		},
+		"to_integer": {
+			name: "to_integer",
+			arguments: []ArgSpec{
+				{types: []JPType{JPAny}},
+			},
+			handler: JPfToInteger,
+		},
+		"parse_json": {
+			name: "parse_json",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+			},
+			handler:   JPfParseJSON,
+			needsIntr: true,
+		},
+		"to_json": {
+			name: "to_json",
+			arguments: []ArgSpec{
+				{types: []JPType{JPAny}},
+				{types: []JPType{JPNumber, JPString}, optional: true},
+			},
+			handler: JPfToJSON,
+		},
+		"base64_encode": {
+			name: "base64_encode",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+			},
+			handler: JPfBase64Encode,
+		},
+		"base64_decode": {
+			name: "base64_decode",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+			},
+			handler: JPfBase64Decode,
+		},
+		"url_encode": {
+			name: "url_encode",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+			},
+			handler: JPfURLEncode,
+		},
+		"url_decode": {
+			name: "url_decode",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+			},
+			handler: JPfURLDecode,
+		},
+		"hex_encode": {
+			name: "hex_encode",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+			},
+			handler: JPfHexEncode,
+		},
+		"sha256": {
+			name: "sha256",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+			},
+			handler: JPfSHA256,
+		},
+		"md5": {
+			name: "md5",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+			},
+			handler: JPfMD5,
+		},
+		"uuid_v5": {
+			name: "uuid_v5",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+			},
+			handler: JPfUUIDv5,
+		},
+		"html_escape": {
+			name: "html_escape",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+			},
+			handler: JPfHTMLEscape,
+		},
+		"ip_in_cidr": {
+			name: "ip_in_cidr",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+			},
+			handler: JPfIPInCIDR,
+		},
+		"ip_version": {
+			name: "ip_version",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+			},
+			handler: JPfIPVersion,
+		},
+		"cidr_contains": {
+			name: "cidr_contains",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+			},
+			handler: JPfCIDRContains,
+		},
+		"is_private_ip": {
+			name: "is_private_ip",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+			},
+			handler: JPfIsPrivateIP,
+		},
+		"parse_url": {
+			name: "parse_url",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+			},
+			handler:   JPfParseURL,
+			needsIntr: true,
+		},
+		"semver_compare": {
+			name: "semver_compare",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+			},
+			handler: JPfSemverCompare,
+		},
+		"semver_satisfies": {
+			name: "semver_satisfies",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+			},
+			handler: JPfSemverSatisfies,
+		},
+		"semver_parse": {
+			name: "semver_parse",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+			},
+			handler:   JPfSemverParse,
+			needsIntr: true,
+		},
+		"semver_key": {
+			name: "semver_key",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+			},
+			handler: JPfSemverKey,
+		},
+		// match and find_all are short names for regex_match and
+		// regex_find_all.  The other regex functions have none, since
+		// find_first, replace and split are the substring functions.
+		"match": {
+			name: "match",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+			},
+			handler:   JPfRegexMatch,
+			needsIntr: true,
+		},
+		"find_all": {
+			name: "find_all",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+			},
+			handler:   JPfRegexFindAll,
+			needsIntr: true,
+		},
+		"regex_match": {
+			name: "regex_match",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+			},
+			handler:   JPfRegexMatch,
+			needsIntr: true,
+		},
+		"regex_find_first": {
+			name: "regex_find_first",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+			},
+			handler:   JPfRegexFindFirst,
+			needsIntr: true,
+		},
+		"regex_find_all": {
+			name: "regex_find_all",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+			},
+			handler:   JPfRegexFindAll,
+			needsIntr: true,
+		},
+		"regex_replace": {
+			name: "regex_replace",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+			},
+			handler:   JPfRegexReplace,
+			needsIntr: true,
+		},
+		"regex_split": {
+			name: "regex_split",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+			},
+			handler:   JPfRegexSplit,
+			needsIntr: true,
+		},
+		"lower": {
+			name: "lower",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+			},
+			handler: JPfLower,
+		},
+		"upper": {
+			name: "upper",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+			},
+			handler: JPfUpper,
+		},
+		"trim": {
+			name: "trim",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}, optional: true},
+			},
+			handler: JPfTrim,
+		},
+		"trim_left": {
+			name: "trim_left",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}, optional: true},
+			},
+			handler: JPfTrimLeft,
+		},
+		"trim_right": {
+			name: "trim_right",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}, optional: true},
+			},
+			handler: JPfTrimRight,
+		},
+		"split": {
+			name: "split",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+				{types: []JPType{JPNumber}, optional: true},
+			},
+			handler: JPfSplit,
+		},
+		"replace": {
+			name: "replace",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+				{types: []JPType{JPNumber}, optional: true},
+			},
+			handler: JPfReplace,
+		},
+		"pad_left": {
+			name: "pad_left",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPNumber}},
+				{types: []JPType{JPString}, optional: true},
+			},
+			handler: JPfPadLeft,
+		},
+		"pad_right": {
+			name: "pad_right",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPNumber}},
+				{types: []JPType{JPString}, optional: true},
+			},
+			handler: JPfPadRight,
+		},
+		"substr": {
+			name: "substr",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPNumber}},
+				{types: []JPType{JPNumber}, optional: true},
+			},
+			handler: JPfSubstr,
+		},
+		"find_first": {
+			name: "find_first",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+				{types: []JPType{JPNumber}, optional: true},
+				{types: []JPType{JPNumber}, optional: true},
+			},
+			handler: JPfFindFirst,
+		},
+		"find_last": {
+			name: "find_last",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}},
+				{types: []JPType{JPNumber}, optional: true},
+				{types: []JPType{JPNumber}, optional: true},
+			},
+			handler: JPfFindLast,
+		},
+		"to_epoch": {
+			name: "to_epoch",
+			arguments: []ArgSpec{
+				{types: []JPType{JPString}},
+				{types: []JPType{JPString}, optional: true},
+			},
+			handler: JPfToEpoch,
+		},
+		"from_epoch": {
+			name: "from_epoch",
+			arguments: []ArgSpec{
+				{types: []JPType{JPNumber}},
+				{types: []JPType{JPString}, optional: true},
+			},
+			handler: JPfFromEpoch,
+		},
+		"now": {
+			name:      "now",
+			arguments: []ArgSpec{},
+			handler:   JPfNow,
+			needsIntr: true,
+		},
+		"date_add": {
+			name: "date_add",
+			arguments: []ArgSpec{
+				{types: []JPType{JPNumber, JPString}},
+				{types: []JPType{JPNumber}},
+				{types: []JPType{JPString}},
+			},
+			handler: JPfDateAdd,
+		},
+		"date_diff": {
+			name: "date_diff",
+			arguments: []ArgSpec{
+				{types: []JPType{JPNumber, JPString}},
+				{types: []JPType{JPNumber, JPString}},
+				{types: []JPType{JPString}, optional: true},
+			},
+			handler: JPfDateDiff,
+		},
+		"date_trunc": {
+			name: "date_trunc",
+			arguments: []ArgSpec{
+				{types: []JPType{JPNumber, JPString}},
+				{types: []JPType{JPString}},
+			},
+			handler: JPfDateTrunc,
+		},
+		"items": {
+			name: "items",
+			arguments: []ArgSpec{
+				{types: []JPType{JPObject}},
+			},
+			handler:   JPfItems,
+			needsIntr: true,
+		},
+		"from_items": {
+			name: "from_items",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}},
+			},
+			handler:   JPfFromItems,
+			needsIntr: true,
+		},
+		"zip": {
+			name: "zip",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}, variadic: true},
+			},
+			handler: JPfZip,
+		},
+		"group_by": {
+			name: "group_by",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}},
+				{types: []JPType{JPExpref}},
+			},
+			handler:   JPfGroupBy,
+			hasExpRef: true,
+		},
+		"count_by": {
+			name: "count_by",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}},
+				{types: []JPType{JPExpref}},
+			},
+			handler:   JPfCountBy,
+			hasExpRef: true,
+		},
+		"sum_by": {
+			name: "sum_by",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}},
+				{types: []JPType{JPExpref}},
+			},
+			handler:   JPfSumBy,
+			hasExpRef: true,
+		},
+		"avg_by": {
+			name: "avg_by",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}},
+				{types: []JPType{JPExpref}},
+			},
+			handler:   JPfAvgBy,
+			hasExpRef: true,
+		},
+		"unique_by": {
+			name: "unique_by",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}},
+				{types: []JPType{JPExpref}},
+			},
+			handler:   JPfUniqueBy,
+			hasExpRef: true,
+		},
+		"distinct": {
+			name: "distinct",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}},
+			},
+			handler: JPfDistinct,
+		},
+		"slice": {
+			name: "slice",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}},
+				{types: []JPType{JPNumber}},
+				{types: []JPType{JPNumber}, optional: true},
+				{types: []JPType{JPNumber}, optional: true},
+			},
+			handler: JPfSlice,
+		},
+		"flatten_deep": {
+			name: "flatten_deep",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}},
+			},
+			handler: JPfFlattenDeep,
+		},
+		"chunk": {
+			name: "chunk",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}},
+				{types: []JPType{JPNumber}},
+			},
+			handler: JPfChunk,
+		},
+		"first": {
+			name: "first",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}},
+			},
+			handler: JPfFirst,
+		},
+		"last": {
+			name: "last",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}},
+			},
+			handler: JPfLast,
+		},
+		"index_of": {
+			name: "index_of",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}},
+				{types: []JPType{JPAny}},
+			},
+			handler: JPfIndexOf,
+		},
+		"concat": {
+			name: "concat",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}, variadic: true},
+			},
+			handler: JPfConcat,
+		},
+		"unique": {
+			name: "unique",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}},
+			},
+			handler: JPfDistinct,
+		},
+		"difference": {
+			name: "difference",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}},
+				{types: []JPType{JPArray}},
+			},
+			handler: JPfDifference,
+		},
+		"intersection": {
+			name: "intersection",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}},
+				{types: []JPType{JPArray}},
+			},
+			handler: JPfIntersection,
+		},
+		"union": {
+			name: "union",
+			arguments: []ArgSpec{
+				{types: []JPType{JPArray}},
+				{types: []JPType{JPArray}},
+			},
+			handler: JPfUnion,
+		},
+		"range": {
+			name: "range",
+			arguments: []ArgSpec{
+				{types: []JPType{JPNumber}},
+				{types: []JPType{JPNumber}},
+				{types: []JPType{JPNumber}, optional: true},
+			},
+			handler: JPfRange,
+		},
+		"deep_merge": {
+			name: "deep_merge",
+			arguments: []ArgSpec{
+				{types: []JPType{JPObject}, variadic: true},
+			},
+			handler:   JPfDeepMerge,
+			needsIntr: true,
+		},
+		"pick": {
+			name: "pick",
+			arguments: []ArgSpec{
+				{types: []JPType{JPObject}},
+				{types: []JPType{JPArrayString}},
+			},
+			handler:   JPfPick,
+			needsIntr: true,
+		},
+		"omit": {
+			name: "omit",
+			arguments: []ArgSpec{
+				{types: []JPType{JPObject}},
+				{types: []JPType{JPArrayString}},
+			},
+			handler:   JPfOmit,
+			needsIntr: true,
+		},
+		"rename_keys": {
+			name: "rename_keys",
+			arguments: []ArgSpec{
+				{types: []JPType{JPObject}},
+				{types: []JPType{JPObject}},
+			},
+			handler:   JPfRenameKeys,
+			needsIntr: true,
+		},
+		"get": {
+			name: "get",
+			arguments: []ArgSpec{
+				{types: []JPType{JPObject, JPArray}},
+				{types: []JPType{JPString}},
+				{types: []JPType{JPAny}, optional: true},
+			},
+			handler:   JPfGet,
+			needsIntr: true,
+		},
+		"set": {
+			name: "set",
+			arguments: []ArgSpec{
+				{types: []JPType{JPObject}},
+				{types: []JPType{JPString}},
+				{types: []JPType{JPAny}},
+			},
+			handler:   JPfSet,
+			needsIntr: true,
+		},
+	}
+	return caller
+}
+
+func (e *FunctionEntry) resolveArgs(arguments []interface{}) ([]interface{}, error) {
+	if len(e.arguments) == 0 || !e.arguments[len(e.arguments)-1].variadic {
+		required := 0
+		for _, spec := range e.arguments {
+			if !spec.optional {
+				required++
+			}
+		}
+		if len(arguments) < required || len(arguments) > len(e.arguments) {
+			return nil, errors.New("incorrect number of args")
+		}
+		for i, userArg := range arguments {
+			arguments[i] = e.arguments[i].normalize(userArg)
+			err := e.arguments[i].typeCheck(arguments[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return arguments, nil
+	}
+	if len(arguments) < len(e.arguments) {
+		return nil, errors.New("Invalid arity.")
+	}
+	for i, userArg := range arguments {
+		spec := e.arguments[len(e.arguments)-1]
+		if i < len(e.arguments) {
+			spec = e.arguments[i]
+		}
+		arguments[i] = spec.normalize(userArg)
+		err := spec.typeCheck(arguments[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return arguments, nil
+}
+
+// normalize converts a slice of any element type passed for an array
+// argument, such as the []string field of a struct, to the []interface{}
+// the functions work on.
+func (a *ArgSpec) normalize(arg interface{}) interface{} {
+	if _, ok := arg.([]interface{}); ok || !isSliceType(arg) {
+		return arg
+	}
+	for _, t := range a.types {
+		if t == JPArray || t == JPArrayNumber || t == JPArrayString {
+			converted, _ := toInterfaceSlice(arg)
+			return converted
+		}
+	}
+	return arg
+}
+
+func (a *ArgSpec) typeCheck(arg interface{}) error {
+	for _, t := range a.types {
+		switch t {
+		case JPNumber:
+			if _, ok := arg.(float64); ok {
+				return nil
+			}
+		case JPString:
+			if _, ok := arg.(string); ok {
+				return nil
+			}
+		case JPArray:
+			if isSliceType(arg) {
+				return nil
+			}
+		case JPObject:
+			if isObject(arg) {
+				return nil
+			}
+		case JPArrayNumber:
+			if _, ok := toArrayNum(arg); ok {
+				return nil
+			}
+		case JPArrayString:
+			if _, ok := toArrayStr(arg); ok {
+				return nil
+			}
+		case JPAny:
+			return nil
+		case JPExpref:
+			if _, ok := arg.(expRef); ok {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("Invalid type for: %v, expected: %#v", arg, a.types)
+}
+
+func (f *functionCaller) AddCustomFunction(custom FunctionEntry) error {
+	_, ok := f.functionTable[custom.name]
+	if ok {
+		return fmt.Errorf("function with name %s already defined", custom.name)
+	}
+	f.functionTable[custom.name] = custom
+	return nil
+}
+
+func (f *functionCaller) CallFunction(name string, arguments []interface{}, intr *treeInterpreter) (interface{}, error) {
+	entry, ok := f.functionTable[name]
+	if !ok {
+		return nil, errors.New("unknown function: " + name)
+	}
+	resolvedArgs, err := entry.resolveArgs(arguments)
+	if err != nil {
+		return nil, err
+	}
+	if entry.hasExpRef || entry.needsIntr {
+		var extra []interface{}
+		extra = append(extra, intr)
+		resolvedArgs = append(extra, resolvedArgs...)
+	}
+	return entry.handler(resolvedArgs)
+}
+
+func JPfAbs(arguments []interface{}) (interface{}, error) {
+	num := arguments[0].(float64)
+	return math.Abs(num), nil
+}
+
+func JPfLength(arguments []interface{}) (interface{}, error) {
+	arg := arguments[0]
+	if c, ok := arg.(string); ok {
+		return float64(utf8.RuneCountInString(c)), nil
+	} else if isSliceType(arg) {
+		v := reflect.ValueOf(arg)
+		return float64(v.Len()), nil
+	} else if isObject(arg) {
+		return float64(objectLen(arg)), nil
+	}
+	return nil, errors.New("could not compute length()")
+}
+
 func JPfStartsWith(arguments []interface{}) (interface{}, error) {
 	search := arguments[0].(string)
-	prefix := arguments[1].(string)
-	return strings.HasPrefix(search, prefix), nil
+	prefix := arguments[1].(string)
+	return strings.HasPrefix(search, prefix), nil
+}
+
+func JPfAvg(arguments []interface{}) (interface{}, error) {
+	// We've already type checked the value so we can safely use
+	// type assertions.
+	args := arguments[0].([]interface{})
+	length := float64(len(args))
+	numerator := 0.0
+	for _, n := range args {
+		numerator += n.(float64)
+	}
+	return numerator / length, nil
+}
+func JPfCeil(arguments []interface{}) (interface{}, error) {
+	val := arguments[0].(float64)
+	return math.Ceil(val), nil
+}
+func JPfContains(arguments []interface{}) (interface{}, error) {
+	search := arguments[0]
+	el := arguments[1]
+	if searchStr, ok := search.(string); ok {
+		if elStr, ok := el.(string); ok {
+			return strings.Contains(searchStr, elStr), nil
+		}
+		return false, nil
+	}
+	// Otherwise this is a generic contains for []interface{}
+	general := search.([]interface{})
+	for _, item := range general {
+		if item == el {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+func JPfEndsWith(arguments []interface{}) (interface{}, error) {
+	search := arguments[0].(string)
+	suffix := arguments[1].(string)
+	return strings.HasSuffix(search, suffix), nil
+}
+func JPfFloor(arguments []interface{}) (interface{}, error) {
+	val := arguments[0].(float64)
+	return math.Floor(val), nil
+}
+
+// finite returns n, or null if n is NaN or infinite.  The math functions
+// return null instead of numbers that can't be represented in JSON, such
+// as the results of sqrt(`-1`) or pow(`0`, `-1`).
+func finite(n float64) interface{} {
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return nil
+	}
+	return n
+}
+func JPfRound(arguments []interface{}) (interface{}, error) {
+	val := arguments[0].(float64)
+	if len(arguments) == 1 {
+		return math.Round(val), nil
+	}
+	digits, err := toInteger(arguments[1])
+	if err != nil {
+		return nil, err
+	}
+	scale := math.Pow(10, float64(digits))
+	rounded := math.Round(val*scale) / scale
+	if math.IsNaN(rounded) || math.IsInf(rounded, 0) {
+		// The number has fewer digits than requested.
+		return val, nil
+	}
+	return rounded, nil
+}
+func JPfPow(arguments []interface{}) (interface{}, error) {
+	return finite(math.Pow(arguments[0].(float64), arguments[1].(float64))), nil
+}
+func JPfSqrt(arguments []interface{}) (interface{}, error) {
+	return finite(math.Sqrt(arguments[0].(float64))), nil
+}
+func JPfLog(arguments []interface{}) (interface{}, error) {
+	val := arguments[0].(float64)
+	if len(arguments) == 1 {
+		return finite(math.Log(val)), nil
+	}
+	return finite(math.Log(val) / math.Log(arguments[1].(float64))), nil
+}
+func JPfExp(arguments []interface{}) (interface{}, error) {
+	return finite(math.Exp(arguments[0].(float64))), nil
+}
+
+// JPfMod returns the remainder of dividing the first argument by the
+// second, which has the sign of the first argument like Go's % operator.
+func JPfMod(arguments []interface{}) (interface{}, error) {
+	return finite(math.Mod(arguments[0].(float64), arguments[1].(float64))), nil
+}
+func JPfClamp(arguments []interface{}) (interface{}, error) {
+	val := arguments[0].(float64)
+	lo := arguments[1].(float64)
+	hi := arguments[2].(float64)
+	if lo > hi {
+		return nil, errors.New("invalid value, lower bound is greater than upper bound")
+	}
+	return math.Max(lo, math.Min(hi, val)), nil
+}
+
+// sortedNumbers returns a sorted copy of an array of numbers.
+func sortedNumbers(arg interface{}) []float64 {
+	items, _ := toArrayNum(arg)
+	sort.Float64s(items)
+	return items
+}
+
+// percentile returns the p-th percentile of sorted, interpolating linearly
+// between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := math.Floor(rank)
+	upper := math.Ceil(rank)
+	return sorted[int(lower)] + (sorted[int(upper)]-sorted[int(lower)])*(rank-lower)
+}
+func JPfMedian(arguments []interface{}) (interface{}, error) {
+	sorted := sortedNumbers(arguments[0])
+	if len(sorted) == 0 {
+		return nil, nil
+	}
+	return finite(percentile(sorted, 50)), nil
+}
+func JPfPercentile(arguments []interface{}) (interface{}, error) {
+	p := arguments[1].(float64)
+	if p < 0 || p > 100 {
+		return nil, errors.New("invalid value, percentile must be between 0 and 100")
+	}
+	sorted := sortedNumbers(arguments[0])
+	if len(sorted) == 0 {
+		return nil, nil
+	}
+	return finite(percentile(sorted, p)), nil
+}
+
+// JPfStddev returns the population standard deviation of an array of
+// numbers.
+func JPfStddev(arguments []interface{}) (interface{}, error) {
+	items, _ := toArrayNum(arguments[0])
+	if len(items) == 0 {
+		return nil, nil
+	}
+	mean := 0.0
+	for _, n := range items {
+		mean += n
+	}
+	mean /= float64(len(items))
+	variance := 0.0
+	for _, n := range items {
+		variance += (n - mean) * (n - mean)
+	}
+	return finite(math.Sqrt(variance / float64(len(items)))), nil
+}
+func JPfProduct(arguments []interface{}) (interface{}, error) {
+	items, _ := toArrayNum(arguments[0])
+	product := 1.0
+	for _, n := range items {
+		product *= n
+	}
+	return finite(product), nil
+}
+func JPfMap(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	exp := arguments[1].(expRef)
+	node := exp.ref
+	arr := arguments[2].([]interface{})
+	mapped := make([]interface{}, 0, len(arr))
+	for _, value := range arr {
+		current, err := intr.Execute(node, value)
+		if err != nil {
+			return nil, err
+		}
+		mapped = append(mapped, current)
+	}
+	return mapped, nil
+}
+
+// findMatch returns the index of the first element of arr for which node
+// evaluates to a truthy value, or -1 if there is none.
+func findMatch(intr *treeInterpreter, node ASTNode, arr []interface{}) (int, error) {
+	for i, value := range arr {
+		result, err := intr.Execute(node, value)
+		if err != nil {
+			return -1, err
+		}
+		if !isFalse(result) {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+func JPfFilter(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	node := arguments[1].(expRef).ref
+	arr := arguments[2].([]interface{})
+	filtered := []interface{}{}
+	for _, value := range arr {
+		result, err := intr.Execute(node, value)
+		if err != nil {
+			return nil, err
+		}
+		if !isFalse(result) {
+			filtered = append(filtered, value)
+		}
+	}
+	return filtered, nil
+}
+
+// JPfReduce folds an array into a single value.  The expression is
+// evaluated once for every element with @ set to an object holding the
+// value accumulated so far, the current element and its index, for
+// example reduce(&sum([accumulated, current]), `[1, 2, 3]`, `0`).
+func JPfReduce(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	node := arguments[1].(expRef).ref
+	arr := arguments[2].([]interface{})
+	accumulated := arguments[3]
+	for i, value := range arr {
+		var err error
+		accumulated, err = intr.Execute(node, map[string]interface{}{
+			"accumulated": accumulated,
+			"current":     value,
+			"index":       float64(i),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return accumulated, nil
+}
+func JPfAny(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	index, err := findMatch(intr, arguments[1].(expRef).ref, arguments[2].([]interface{}))
+	if err != nil {
+		return nil, err
+	}
+	return index >= 0, nil
+}
+func JPfAll(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	node := arguments[1].(expRef).ref
+	for _, value := range arguments[2].([]interface{}) {
+		result, err := intr.Execute(node, value)
+		if err != nil {
+			return nil, err
+		}
+		if isFalse(result) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+func JPfFind(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	arr := arguments[2].([]interface{})
+	index, err := findMatch(intr, arguments[1].(expRef).ref, arr)
+	if err != nil || index < 0 {
+		return nil, err
+	}
+	return arr[index], nil
+}
+func JPfFindIndex(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	index, err := findMatch(intr, arguments[1].(expRef).ref, arguments[2].([]interface{}))
+	if err != nil || index < 0 {
+		return nil, err
+	}
+	return float64(index), nil
+}
+
+// JPfFlatMap is like map, but the arrays returned by the expression are
+// flattened into the result like the [] operator does.
+func JPfFlatMap(arguments []interface{}) (interface{}, error) {
+	mapped, err := JPfMap(arguments)
+	if err != nil {
+		return nil, err
+	}
+	flattened := []interface{}{}
+	for _, value := range mapped.([]interface{}) {
+		if inner, ok := toInterfaceSlice(value); ok {
+			flattened = append(flattened, inner...)
+		} else {
+			flattened = append(flattened, value)
+		}
+	}
+	return flattened, nil
+}
+func JPfMax(arguments []interface{}) (interface{}, error) {
+	return maxValue(arguments[0], Collation{}), nil
+}
+
+// jpfMax is the handler of max(), which compares strings according to
+// Options.Collation.
+func jpfMax(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	return maxValue(arguments[1], intr.opts.Collation), nil
+}
+
+func maxValue(arg interface{}, collation Collation) interface{} {
+	if items, ok := toArrayNum(arg); ok {
+		if len(items) == 0 {
+			return nil
+		}
+		if len(items) == 1 {
+			return items[0]
+		}
+		best := items[0]
+		for _, item := range items[1:] {
+			if item > best {
+				best = item
+			}
+		}
+		return best
+	}
+	// Otherwise we're dealing with a max() of strings.
+	items, _ := toArrayStr(arg)
+	if len(items) == 0 {
+		return nil
+	}
+	if len(items) == 1 {
+		return items[0]
+	}
+	best := items[0]
+	for _, item := range items[1:] {
+		if collation.compare(item, best) > 0 {
+			best = item
+		}
+	}
+	return best
+}
+func JPfMerge(arguments []interface{}) (interface{}, error) {
+	return mergeObjects(arguments, false), nil
+}
+
+// jpfMerge is the handler of merge(), which builds an *OrderedMap when
+// Options.PreserveOrder is set.
+func jpfMerge(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	return mergeObjects(arguments[1:], intr.opts.PreserveOrder), nil
+}
+
+func mergeObjects(objects []interface{}, preserveOrder bool) interface{} {
+	if preserveOrder {
+		// Keys keep the position of their first occurrence while
+		// later objects still override the value.
+		final := NewOrderedMap()
+		for _, m := range objects {
+			for _, key := range objectKeys(m, true) {
+				final.Set(key, objectGet(m, key))
+			}
+		}
+		return final
+	}
+	final := make(map[string]interface{})
+	for _, m := range objects {
+		for _, key := range objectKeys(m, false) {
+			final[key] = objectGet(m, key)
+		}
+	}
+	return final
+}
+func JPfMaxBy(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	arr := arguments[1].([]interface{})
+	exp := arguments[2].(expRef)
+	node := exp.ref
+	if len(arr) == 0 {
+		return nil, nil
+	} else if len(arr) == 1 {
+		return arr[0], nil
+	}
+	start, err := intr.Execute(node, arr[0])
+	if err != nil {
+		return nil, err
+	}
+	switch t := start.(type) {
+	case float64:
+		bestVal := t
+		bestItem := arr[0]
+		for _, item := range arr[1:] {
+			result, err := intr.Execute(node, item)
+			if err != nil {
+				return nil, err
+			}
+			current, ok := result.(float64)
+			if !ok {
+				return nil, errors.New("invalid type, must be number")
+			}
+			if current > bestVal {
+				bestVal = current
+				bestItem = item
+			}
+		}
+		return bestItem, nil
+	case string:
+		bestVal := t
+		bestItem := arr[0]
+		for _, item := range arr[1:] {
+			result, err := intr.Execute(node, item)
+			if err != nil {
+				return nil, err
+			}
+			current, ok := result.(string)
+			if !ok {
+				return nil, errors.New("invalid type, must be string")
+			}
+			if intr.opts.Collation.compare(current, bestVal) > 0 {
+				bestVal = current
+				bestItem = item
+			}
+		}
+		return bestItem, nil
+	default:
+		return nil, errors.New("invalid type, must be number of string")
+	}
+}
+func JPfSum(arguments []interface{}) (interface{}, error) {
+	items, _ := toArrayNum(arguments[0])
+	sum := 0.0
+	for _, item := range items {
+		sum += item
+	}
+	return sum, nil
+}
+
+func JPfMin(arguments []interface{}) (interface{}, error) {
+	return minValue(arguments[0], Collation{}), nil
+}
+
+// jpfMin is the handler of min(), which compares strings according to
+// Options.Collation.
+func jpfMin(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	return minValue(arguments[1], intr.opts.Collation), nil
+}
+
+func minValue(arg interface{}, collation Collation) interface{} {
+	if items, ok := toArrayNum(arg); ok {
+		if len(items) == 0 {
+			return nil
+		}
+		if len(items) == 1 {
+			return items[0]
+		}
+		best := items[0]
+		for _, item := range items[1:] {
+			if item < best {
+				best = item
+			}
+		}
+		return best
+	}
+	items, _ := toArrayStr(arg)
+	if len(items) == 0 {
+		return nil
+	}
+	if len(items) == 1 {
+		return items[0]
+	}
+	best := items[0]
+	for _, item := range items[1:] {
+		if collation.compare(item, best) < 0 {
+			best = item
+		}
+	}
+	return best
+}
+
+func JPfMinBy(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	arr := arguments[1].([]interface{})
+	exp := arguments[2].(expRef)
+	node := exp.ref
+	if len(arr) == 0 {
+		return nil, nil
+	} else if len(arr) == 1 {
+		return arr[0], nil
+	}
+	start, err := intr.Execute(node, arr[0])
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := start.(float64); ok {
+		bestVal := t
+		bestItem := arr[0]
+		for _, item := range arr[1:] {
+			result, err := intr.Execute(node, item)
+			if err != nil {
+				return nil, err
+			}
+			current, ok := result.(float64)
+			if !ok {
+				return nil, errors.New("invalid type, must be number")
+			}
+			if current < bestVal {
+				bestVal = current
+				bestItem = item
+			}
+		}
+		return bestItem, nil
+	} else if t, ok := start.(string); ok {
+		bestVal := t
+		bestItem := arr[0]
+		for _, item := range arr[1:] {
+			result, err := intr.Execute(node, item)
+			if err != nil {
+				return nil, err
+			}
+			current, ok := result.(string)
+			if !ok {
+				return nil, errors.New("invalid type, must be string")
+			}
+			if intr.opts.Collation.compare(current, bestVal) < 0 {
+				bestVal = current
+				bestItem = item
+			}
+		}
+		return bestItem, nil
+	} else {
+		return nil, errors.New("invalid type, must be number of string")
+	}
+}
+func JPfType(arguments []interface{}) (interface{}, error) {
+	if t, ok := jpTypeOf(arguments[0]); ok {
+		return t, nil
+	}
+	return nil, errors.New("unknown type")
+}
+func JPfKeys(arguments []interface{}) (interface{}, error) {
+	return objectKeyList(arguments[0], false), nil
+}
+func JPfValues(arguments []interface{}) (interface{}, error) {
+	return objectValueList(arguments[0], false), nil
+}
+
+// jpfKeys and jpfValues are the handlers of keys() and values(), which
+// visit the keys of a map in sorted order when Options.SortKeys is set.
+func jpfKeys(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	return objectKeyList(arguments[1], intr.opts.SortKeys), nil
+}
+func jpfValues(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	return objectValueList(arguments[1], intr.opts.SortKeys), nil
+}
+
+func objectKeyList(obj interface{}, sorted bool) []interface{} {
+	keys := objectKeys(obj, sorted)
+	collected := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		collected = append(collected, key)
+	}
+	return collected
+}
+
+func objectValueList(obj interface{}, sorted bool) []interface{} {
+	keys := objectKeys(obj, sorted)
+	collected := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		collected = append(collected, objectGet(obj, key))
+	}
+	return collected
+}
+func JPfSort(arguments []interface{}) (interface{}, error) {
+	return sortValues(arguments[0], Collation{}), nil
+}
+
+// jpfSort is the handler of sort(), which orders strings according to
+// Options.Collation.
+func jpfSort(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	return sortValues(arguments[1], intr.opts.Collation), nil
+}
+
+func sortValues(arg interface{}, collation Collation) []interface{} {
+	if items, ok := toArrayNum(arg); ok {
+		d := sort.Float64Slice(items)
+		sort.Stable(d)
+		final := make([]interface{}, len(d))
+		for i, val := range d {
+			final[i] = val
+		}
+		return final
+	}
+	// Otherwise we're dealing with sort()'ing strings.
+	items, _ := toArrayStr(arg)
+	return sortStrings(items, collation)
+}
+
+// sortStrings returns items sorted according to collation, keeping
+// strings that compare equal in their original order.
+func sortStrings(items []string, collation Collation) []interface{} {
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = collation.key(item)
+	}
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return collation.compareKeys(keys[order[a]], keys[order[b]]) < 0
+	})
+	final := make([]interface{}, len(items))
+	for i, index := range order {
+		final[i] = items[index]
+	}
+	return final
+}
+
+// JPfSortBy sorts an array by one or more keys.  Later keys break ties
+// between elements whose earlier keys are equal.
+func JPfSortBy(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	arr := arguments[1].([]interface{})
+	keys, err := newByKeys(intr, arr, arguments[2:])
+	if err != nil {
+		return nil, err
+	}
+	return keys.sort(arr), nil
+}
+
+// JPfReverseSortBy is like sort_by, but sorts in descending order.  Equal
+// elements still keep their original order.
+func JPfReverseSortBy(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	arr := arguments[1].([]interface{})
+	keys, err := newByKeys(intr, arr, arguments[2:])
+	if err != nil {
+		return nil, err
+	}
+	keys.descending = true
+	return keys.sort(arr), nil
+}
+func JPfJoin(arguments []interface{}) (interface{}, error) {
+	sep := arguments[0].(string)
+	// We can't just do arguments[1].([]string), we have to
+	// manually convert each item to a string.
+	arrayStr := []string{}
+	for _, item := range arguments[1].([]interface{}) {
+		arrayStr = append(arrayStr, item.(string))
+	}
+	return strings.Join(arrayStr, sep), nil
+}
+func JPfReverse(arguments []interface{}) (interface{}, error) {
+	if s, ok := arguments[0].(string); ok {
+		r := []rune(s)
+		for i, j := 0, len(r)-1; i < len(r)/2; i, j = i+1, j-1 {
+			r[i], r[j] = r[j], r[i]
+		}
+		return string(r), nil
+	}
+	items := arguments[0].([]interface{})
+	length := len(items)
+	reversed := make([]interface{}, length)
+	for i, item := range items {
+		reversed[length-(i+1)] = item
+	}
+	return reversed, nil
+}
+func JPfToArray(arguments []interface{}) (interface{}, error) {
+	if _, ok := arguments[0].([]interface{}); ok {
+		return arguments[0], nil
+	}
+	return arguments[:1:1], nil
+}
+func JPfToString(arguments []interface{}) (interface{}, error) {
+	if v, ok := arguments[0].(string); ok {
+		return v, nil
+	}
+	result, err := json.Marshal(arguments[0])
+	if err != nil {
+		return nil, err
+	}
+	return string(result), nil
+}
+func JPfToNumber(arguments []interface{}) (interface{}, error) {
+	arg := arguments[0]
+	if v, ok := arg.(float64); ok {
+		return v, nil
+	}
+	if v, ok := arg.(string); ok {
+		conv, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, nil
+		}
+		return conv, nil
+	}
+	if _, ok := arg.([]interface{}); ok {
+		return nil, nil
+	}
+	if isObject(arg) {
+		return nil, nil
+	}
+	if arg == nil {
+		return nil, nil
+	}
+	if arg == true || arg == false {
+		return nil, nil
+	}
+	return nil, errors.New("unknown type")
+}
+
+// hasType reports whether value has the JMESPath type name.
+func hasType(value interface{}, name string) bool {
+	t, _ := jpTypeOf(value)
+	return t == name
+}
+func JPfIsString(arguments []interface{}) (interface{}, error) {
+	return hasType(arguments[0], "string"), nil
+}
+func JPfIsNumber(arguments []interface{}) (interface{}, error) {
+	return hasType(arguments[0], "number"), nil
+}
+func JPfIsArray(arguments []interface{}) (interface{}, error) {
+	return hasType(arguments[0], "array"), nil
+}
+func JPfIsObject(arguments []interface{}) (interface{}, error) {
+	return hasType(arguments[0], "object"), nil
+}
+func JPfIsBoolean(arguments []interface{}) (interface{}, error) {
+	return hasType(arguments[0], "boolean"), nil
+}
+func JPfIsNull(arguments []interface{}) (interface{}, error) {
+	return hasType(arguments[0], "null"), nil
+}
+
+// JPfToBoolean converts booleans, the strings "true" and "false" in any
+// case, and numbers, which are true unless they are zero.  Like to_number,
+// it returns null for values it can't convert.
+func JPfToBoolean(arguments []interface{}) (interface{}, error) {
+	switch v := arguments[0].(type) {
+	case bool:
+		return v, nil
+	case float64:
+		return v != 0, nil
+	case string:
+		switch strings.ToLower(v) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return nil, nil
+}
+
+// JPfToInteger is like to_number, but truncates the number towards zero.
+func JPfToInteger(arguments []interface{}) (interface{}, error) {
+	n, err := JPfToNumber(arguments)
+	if err != nil || n == nil {
+		return n, err
+	}
+	return finite(math.Trunc(n.(float64))), nil
+}
+func JPfParseJSON(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	data := []byte(arguments[1].(string))
+	if intr.opts.PreserveOrder {
+		return UnmarshalOrdered(data)
+	}
+	var parsed interface{}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// JPfToJSON encodes its argument as JSON.  The optional indent is either a
+// number of spaces or the string to indent with.  Unlike to_string it
+// doesn't escape HTML characters such as "<".
+func JPfToJSON(arguments []interface{}) (interface{}, error) {
+	indent := ""
+	if len(arguments) > 1 {
+		var ok bool
+		if indent, ok = arguments[1].(string); !ok {
+			n, err := toInteger(arguments[1])
+			if err != nil || n < 0 {
+				return nil, errors.New("invalid value, indent must be a non-negative integer")
+			}
+			if n > maxGeneratedLength {
+				return nil, fmt.Errorf("invalid value, indent must not exceed %d", maxGeneratedLength)
+			}
+			indent = strings.Repeat(" ", n)
+		}
+	}
+	var buf strings.Builder
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(arguments[0]); err != nil {
+		return nil, err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+func JPfNotNull(arguments []interface{}) (interface{}, error) {
+	for _, arg := range arguments {
+		if arg != nil {
+			return arg, nil
+		}
+	}
+	return nil, nil
+}
+func JPfRegexMatch(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	re, err := intr.compileRegexp(arguments[2].(string))
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(arguments[1].(string)), nil
+}
+func JPfRegexFindFirst(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	re, err := intr.compileRegexp(arguments[2].(string))
+	if err != nil {
+		return nil, err
+	}
+	search := arguments[1].(string)
+	loc := re.FindStringIndex(search)
+	if loc == nil {
+		return nil, nil
+	}
+	return search[loc[0]:loc[1]], nil
+}
+func JPfRegexFindAll(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	re, err := intr.compileRegexp(arguments[2].(string))
+	if err != nil {
+		return nil, err
+	}
+	found := re.FindAllString(arguments[1].(string), -1)
+	collected := make([]interface{}, len(found))
+	for i, match := range found {
+		collected[i] = match
+	}
+	return collected, nil
+}
+func JPfRegexReplace(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	re, err := intr.compileRegexp(arguments[2].(string))
+	if err != nil {
+		return nil, err
+	}
+	return re.ReplaceAllString(arguments[1].(string), arguments[3].(string)), nil
+}
+func JPfRegexSplit(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	re, err := intr.compileRegexp(arguments[2].(string))
+	if err != nil {
+		return nil, err
+	}
+	parts := re.Split(arguments[1].(string), -1)
+	collected := make([]interface{}, len(parts))
+	for i, part := range parts {
+		collected[i] = part
+	}
+	return collected, nil
+}
+func JPfLower(arguments []interface{}) (interface{}, error) {
+	return strings.ToLower(arguments[0].(string)), nil
+}
+func JPfUpper(arguments []interface{}) (interface{}, error) {
+	return strings.ToUpper(arguments[0].(string)), nil
+}
+
+// trimChars returns the optional set of characters to trim, or "" if
+// whitespace should be trimmed.
+func trimChars(arguments []interface{}) string {
+	if len(arguments) > 1 {
+		return arguments[1].(string)
+	}
+	return ""
+}
+func JPfTrim(arguments []interface{}) (interface{}, error) {
+	search := arguments[0].(string)
+	if chars := trimChars(arguments); chars != "" {
+		return strings.Trim(search, chars), nil
+	}
+	return strings.TrimFunc(search, unicode.IsSpace), nil
+}
+func JPfTrimLeft(arguments []interface{}) (interface{}, error) {
+	search := arguments[0].(string)
+	if chars := trimChars(arguments); chars != "" {
+		return strings.TrimLeft(search, chars), nil
+	}
+	return strings.TrimLeftFunc(search, unicode.IsSpace), nil
+}
+func JPfTrimRight(arguments []interface{}) (interface{}, error) {
+	search := arguments[0].(string)
+	if chars := trimChars(arguments); chars != "" {
+		return strings.TrimRight(search, chars), nil
+	}
+	return strings.TrimRightFunc(search, unicode.IsSpace), nil
+}
+func JPfSplit(arguments []interface{}) (interface{}, error) {
+	search := arguments[0].(string)
+	sep := arguments[1].(string)
+	n := -1
+	if len(arguments) > 2 {
+		count, err := toInteger(arguments[2])
+		if err != nil || count < 0 {
+			return nil, errors.New("invalid value, count must be a non-negative integer")
+		}
+		// The count is the number of splits, i.e. one less than the
+		// number of parts.  There can't be more splits than bytes.
+		if count < len(search) {
+			n = count + 1
+		}
+	}
+	parts := strings.SplitN(search, sep, n)
+	collected := make([]interface{}, len(parts))
+	for i, part := range parts {
+		collected[i] = part
+	}
+	return collected, nil
+}
+func JPfReplace(arguments []interface{}) (interface{}, error) {
+	search := arguments[0].(string)
+	n := -1
+	if len(arguments) > 3 {
+		count, err := toInteger(arguments[3])
+		if err != nil || count < 0 {
+			return nil, errors.New("invalid value, count must be a non-negative integer")
+		}
+		n = count
+	}
+	return strings.Replace(search, arguments[1].(string), arguments[2].(string), n), nil
+}
+
+// maxGeneratedLength bounds the length of the strings and arrays that
+// functions such as pad_left() and range() build from number arguments,
+// so that a single expression can't exhaust memory.
+const maxGeneratedLength = 1 << 20
+
+// padding returns the width and padding character for pad_left and
+// pad_right.
+func padding(arguments []interface{}) (int, string, error) {
+	if arguments[1].(float64) > maxGeneratedLength {
+		return 0, "", fmt.Errorf("invalid value, width must not exceed %d", maxGeneratedLength)
+	}
+	width, err := toInteger(arguments[1])
+	if err != nil || width < 0 {
+		return 0, "", errors.New("invalid value, width must be a non-negative integer")
+	}
+	pad := " "
+	if len(arguments) > 2 {
+		pad = arguments[2].(string)
+		if utf8.RuneCountInString(pad) != 1 {
+			return 0, "", errors.New("invalid value, pad must be a single character")
+		}
+	}
+	return width, pad, nil
+}
+func JPfPadLeft(arguments []interface{}) (interface{}, error) {
+	search := arguments[0].(string)
+	width, pad, err := padding(arguments)
+	if err != nil {
+		return nil, err
+	}
+	if missing := width - utf8.RuneCountInString(search); missing > 0 {
+		return strings.Repeat(pad, missing) + search, nil
+	}
+	return search, nil
+}
+func JPfPadRight(arguments []interface{}) (interface{}, error) {
+	search := arguments[0].(string)
+	width, pad, err := padding(arguments)
+	if err != nil {
+		return nil, err
+	}
+	if missing := width - utf8.RuneCountInString(search); missing > 0 {
+		return search + strings.Repeat(pad, missing), nil
+	}
+	return search, nil
+}
+func JPfSubstr(arguments []interface{}) (interface{}, error) {
+	runes := []rune(arguments[0].(string))
+	start, err := toInteger(arguments[1])
+	if err != nil {
+		return nil, err
+	}
+	start = capSlice(len(runes), start, 1)
+	end := len(runes)
+	if len(arguments) > 2 {
+		length, err := toInteger(arguments[2])
+		if err != nil || length < 0 {
+			return nil, errors.New("invalid value, length must be a non-negative integer")
+		}
+		if length < end-start {
+			end = start + length
+		}
+	}
+	return string(runes[start:end]), nil
+}
+
+// searchBounds returns the part of subject that find_first and find_last
+// search in, along with its offset.  The optional start and end arguments
+// follow the rules of slice expressions.
+func searchBounds(arguments []interface{}) ([]rune, int, error) {
+	subject := []rune(arguments[0].(string))
+	parts := make([]sliceParam, 3)
+	for i := 0; i < 2 && i+2 < len(arguments); i++ {
+		n, err := toInteger(arguments[i+2])
+		if err != nil {
+			return nil, 0, err
+		}
+		parts[i] = sliceParam{N: n, Specified: true}
+	}
+	computed, err := computeSliceParams(len(subject), parts)
+	if err != nil {
+		return nil, 0, err
+	}
+	start, stop := computed[0], computed[1]
+	if stop < start {
+		return []rune{}, start, nil
+	}
+	return subject[start:stop], start, nil
+}
+func JPfFindFirst(arguments []interface{}) (interface{}, error) {
+	window, offset, err := searchBounds(arguments)
+	if err != nil {
+		return nil, err
+	}
+	sub := []rune(arguments[1].(string))
+	for i := 0; i+len(sub) <= len(window); i++ {
+		if runesEqual(window[i:i+len(sub)], sub) {
+			return float64(offset + i), nil
+		}
+	}
+	return nil, nil
+}
+func JPfFindLast(arguments []interface{}) (interface{}, error) {
+	window, offset, err := searchBounds(arguments)
+	if err != nil {
+		return nil, err
+	}
+	sub := []rune(arguments[1].(string))
+	for i := len(window) - len(sub); i >= 0; i-- {
+		if runesEqual(window[i:i+len(sub)], sub) {
+			return float64(offset + i), nil
+		}
+	}
+	return nil, nil
+}
+func runesEqual(a, b []rune) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// minTime and maxTime bound the times the date functions compute, the
+// years 1 to 9999 that RFC 3339 timestamps can represent.  Staying inside
+// them also keeps the conversions to int64 seconds and to time.Duration
+// from overflowing.
+var (
+	minTime = time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)
+	maxTime = time.Date(9999, 12, 31, 23, 59, 59, 999999999, time.UTC)
+)
+
+var errTimeRange = errors.New("invalid value, times must be between the years 1 and 9999")
+
+// epochToTime converts a number of seconds since the Unix epoch, which may
+// have a fractional part, to a time in UTC.
+func epochToTime(epoch float64) (time.Time, error) {
+	if math.IsNaN(epoch) || math.IsInf(epoch, 0) {
+		return time.Time{}, errors.New("invalid value, expected a finite number of seconds")
+	}
+	if epoch < float64(minTime.Unix()) || epoch >= float64(maxTime.Unix()+1) {
+		return time.Time{}, errTimeRange
+	}
+	seconds := math.Floor(epoch)
+	nanos := math.Round((epoch - seconds) * 1e9)
+	return time.Unix(int64(seconds), int64(nanos)).UTC(), nil
+}
+
+func timeToEpoch(t time.Time) float64 {
+	return float64(t.Unix()) + float64(t.Nanosecond())/1e9
+}
+
+// timeArg converts a timestamp argument, either seconds since the epoch
+// or an RFC 3339 string, to a time.
+func timeArg(arg interface{}) (time.Time, error) {
+	if s, ok := arg.(string); ok {
+		return time.Parse(time.RFC3339, s)
+	}
+	return epochToTime(arg.(float64))
+}
+
+// timeResult returns t in the same form as the timestamp argument it was
+// computed from: seconds since the epoch for a number, or an RFC 3339
+// string in the original time zone offset for a string.
+func timeResult(t time.Time, arg interface{}) interface{} {
+	if _, ok := arg.(string); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	return timeToEpoch(t)
+}
+
+// timeUnit normalizes the unit argument of the date functions, accepting
+// both singular and plural names.
+func timeUnit(unit string) (string, error) {
+	unit = strings.TrimSuffix(unit, "s")
+	switch unit {
+	case "second", "minute", "hour", "day", "week", "month", "year":
+		return unit, nil
+	}
+	return "", fmt.Errorf("invalid unit %q, expected one of second, minute, hour, day, week, month or year", unit)
+}
+
+var unitDurations = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+}
+
+func JPfToEpoch(arguments []interface{}) (interface{}, error) {
+	layout := time.RFC3339
+	if len(arguments) > 1 {
+		layout = arguments[1].(string)
+	}
+	t, err := time.Parse(layout, arguments[0].(string))
+	if err != nil {
+		return nil, err
+	}
+	return timeToEpoch(t), nil
+}
+func JPfFromEpoch(arguments []interface{}) (interface{}, error) {
+	t, err := epochToTime(arguments[0].(float64))
+	if err != nil {
+		return nil, err
+	}
+	layout := time.RFC3339Nano
+	if len(arguments) > 1 {
+		layout = arguments[1].(string)
+	}
+	return t.Format(layout), nil
+}
+func JPfNow(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	now := time.Now
+	if intr.opts.Clock != nil {
+		now = intr.opts.Clock
+	}
+	return timeToEpoch(now()), nil
+}
+func JPfDateAdd(arguments []interface{}) (interface{}, error) {
+	t, err := timeArg(arguments[0])
+	if err != nil {
+		return nil, err
+	}
+	unit, err := timeUnit(arguments[2].(string))
+	if err != nil {
+		return nil, err
+	}
+	amount := arguments[1].(float64)
+	switch unit {
+	case "month", "year":
+		n, err := toInteger(amount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value, %s can only be added in whole numbers", unit)
+		}
+		// Anything longer than the years a time can have is out of
+		// range, and checking first keeps AddDate from overflowing.
+		limit := 12 * 10000
+		if unit == "year" {
+			limit = 10000
+		}
+		if n > limit || n < -limit {
+			return nil, errTimeRange
+		}
+		if unit == "year" {
+			t = t.AddDate(n, 0, 0)
+		} else {
+			t = t.AddDate(0, n, 0)
+		}
+	default:
+		duration := amount * float64(unitDurations[unit])
+		if duration < math.MinInt64 || duration >= math.MaxInt64 {
+			return nil, errTimeRange
+		}
+		t = t.Add(time.Duration(duration))
+	}
+	if t.Before(minTime) || t.After(maxTime) {
+		return nil, errTimeRange
+	}
+	return timeResult(t, arguments[0]), nil
 }
 
-func JPfAvg(arguments []interface{}) (interface{}, error) {
-	// We've already type checked the value so we can safely use
-	// type assertions.
-	args := arguments[0].([]interface{})
-	length := float64(len(args))
-	numerator := 0.0
-	for _, n := range args {
-		numerator += n.(float64)
+// monthsBetween returns the number of whole calendar months from start to
+// end, which is negative if end is before start.
+func monthsBetween(start, end time.Time) int {
+	if end.Before(start) {
+		return -monthsBetween(end, start)
 	}
-	return numerator / length, nil
+	months := (end.Year()-start.Year())*12 + int(end.Month()-start.Month())
+	if months > 0 && start.AddDate(0, months, 0).After(end) {
+		months--
+	}
+	return months
 }
-func JPfCeil(arguments []interface{}) (interface{}, error) {
-	val := arguments[0].(float64)
-	return math.Ceil(val), nil
+func JPfDateDiff(arguments []interface{}) (interface{}, error) {
+	end, err := timeArg(arguments[0])
+	if err != nil {
+		return nil, err
+	}
+	start, err := timeArg(arguments[1])
+	if err != nil {
+		return nil, err
+	}
+	unit := "second"
+	if len(arguments) > 2 {
+		if unit, err = timeUnit(arguments[2].(string)); err != nil {
+			return nil, err
+		}
+	}
+	switch unit {
+	case "month":
+		return float64(monthsBetween(start, end)), nil
+	case "year":
+		return float64(monthsBetween(start, end) / 12), nil
+	}
+	return float64(end.Sub(start)) / float64(unitDurations[unit]), nil
 }
-func JPfContains(arguments []interface{}) (interface{}, error) {
-	search := arguments[0]
-	el := arguments[1]
-	if searchStr, ok := search.(string); ok {
-		if elStr, ok := el.(string); ok {
-			return strings.Contains(searchStr, elStr), nil
+func JPfDateTrunc(arguments []interface{}) (interface{}, error) {
+	t, err := timeArg(arguments[0])
+	if err != nil {
+		return nil, err
+	}
+	unit, err := timeUnit(arguments[1].(string))
+	if err != nil {
+		return nil, err
+	}
+	year, month, day := t.Date()
+	hour, min, sec := t.Clock()
+	switch unit {
+	case "second":
+		t = time.Date(year, month, day, hour, min, sec, 0, t.Location())
+	case "minute":
+		t = time.Date(year, month, day, hour, min, 0, 0, t.Location())
+	case "hour":
+		t = time.Date(year, month, day, hour, 0, 0, 0, t.Location())
+	case "day":
+		t = time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	case "week":
+		// Weeks start on Monday.
+		offset := (int(t.Weekday()) + 6) % 7
+		t = time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location())
+	case "month":
+		t = time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	case "year":
+		t = time.Date(year, time.January, 1, 0, 0, 0, 0, t.Location())
+	}
+	return timeResult(t, arguments[0]), nil
+}
+func JPfItems(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	arg := arguments[1]
+	keys := objectKeys(arg, intr.opts.SortKeys)
+	collected := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		collected = append(collected, []interface{}{key, objectGet(arg, key)})
+	}
+	return collected, nil
+}
+func JPfFromItems(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	pairs := arguments[1].([]interface{})
+	ordered := NewOrderedMap()
+	for _, item := range pairs {
+		pair, ok := toInterfaceSlice(item)
+		if !ok || len(pair) != 2 {
+			return nil, fmt.Errorf("invalid item %v, expected a [key, value] pair", item)
 		}
-		return false, nil
+		key, ok := pair[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid key %v, expected a string", pair[0])
+		}
+		// Like merge(), a later pair overrides the value of an earlier
+		// one with the same key.
+		ordered.Set(key, pair[1])
 	}
-	// Otherwise this is a generic contains for []interface{}
-	general := search.([]interface{})
-	for _, item := range general {
-		if item == el {
-			return true, nil
+	return intr.buildObject(ordered), nil
+}
+func JPfZip(arguments []interface{}) (interface{}, error) {
+	// The result is as long as the shortest array.
+	length := -1
+	for _, arg := range arguments {
+		if n := len(arg.([]interface{})); length < 0 || n < length {
+			length = n
 		}
 	}
-	return false, nil
+	collected := make([]interface{}, length)
+	for i := range collected {
+		tuple := make([]interface{}, len(arguments))
+		for j, arg := range arguments {
+			tuple[j] = arg.([]interface{})[i]
+		}
+		collected[i] = tuple
+	}
+	return collected, nil
 }
-func JPfEndsWith(arguments []interface{}) (interface{}, error) {
-	search := arguments[0].(string)
-	suffix := arguments[1].(string)
-	return strings.HasSuffix(search, suffix), nil
+
+// buildObject returns the object built by a function, keeping the key
+// order of ordered if PreserveOrder is set.
+func (intr *treeInterpreter) buildObject(ordered *OrderedMap) interface{} {
+	if intr.opts.PreserveOrder {
+		return ordered
+	}
+	final := make(map[string]interface{}, ordered.Len())
+	for _, key := range ordered.Keys() {
+		final[key], _ = ordered.Get(key)
+	}
+	return final
 }
-func JPfFloor(arguments []interface{}) (interface{}, error) {
-	val := arguments[0].(float64)
-	return math.Floor(val), nil
+
+// groupKey evaluates the key expression of group_by and count_by against
+// item.  Items whose key is null don't belong to any group.
+func groupKey(intr *treeInterpreter, node ASTNode, item interface{}) (string, bool, error) {
+	result, err := intr.Execute(node, item)
+	if err != nil {
+		return "", false, err
+	}
+	if result == nil {
+		return "", false, nil
+	}
+	key, ok := result.(string)
+	if !ok {
+		return "", false, fmt.Errorf("invalid type, group key must be a string, got %v", result)
+	}
+	return key, true, nil
 }
-func JPfMap(arguments []interface{}) (interface{}, error) {
+func JPfGroupBy(arguments []interface{}) (interface{}, error) {
 	intr := arguments[0].(*treeInterpreter)
-	exp := arguments[1].(expRef)
-	node := exp.ref
-	arr := arguments[2].([]interface{})
-	mapped := make([]interface{}, 0, len(arr))
-	for _, value := range arr {
-		current, err := intr.Execute(node, value)
+	arr := arguments[1].([]interface{})
+	node := arguments[2].(expRef).ref
+	groups := NewOrderedMap()
+	for _, item := range arr {
+		key, ok, err := groupKey(intr, node, item)
 		if err != nil {
 			return nil, err
 		}
-		mapped = append(mapped, current)
+		if !ok {
+			continue
+		}
+		group, _ := groups.Get(key)
+		if group == nil {
+			group = []interface{}{}
+		}
+		groups.Set(key, append(group.([]interface{}), item))
 	}
-	return mapped, nil
+	return intr.buildObject(groups), nil
 }
-func JPfMax(arguments []interface{}) (interface{}, error) {
-	if items, ok := toArrayNum(arguments[0]); ok {
-		if len(items) == 0 {
-			return nil, nil
+func JPfCountBy(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	arr := arguments[1].([]interface{})
+	node := arguments[2].(expRef).ref
+	counts := NewOrderedMap()
+	for _, item := range arr {
+		key, ok, err := groupKey(intr, node, item)
+		if err != nil {
+			return nil, err
 		}
-		if len(items) == 1 {
-			return items[0], nil
+		if !ok {
+			continue
 		}
-		best := items[0]
-		for _, item := range items[1:] {
-			if item > best {
-				best = item
-			}
+		count, _ := counts.Get(key)
+		if count == nil {
+			count = 0.0
 		}
-		return best, nil
+		counts.Set(key, count.(float64)+1)
 	}
-	// Otherwise we're dealing with a max() of strings.
-	items, _ := toArrayStr(arguments[0])
-	if len(items) == 0 {
+	return intr.buildObject(counts), nil
+}
+
+// numbersBy evaluates node against every element of arr, which must
+// produce a number for each of them.
+func numbersBy(intr *treeInterpreter, node ASTNode, arr []interface{}) ([]float64, error) {
+	numbers := make([]float64, len(arr))
+	for i, item := range arr {
+		result, err := intr.Execute(node, item)
+		if err != nil {
+			return nil, err
+		}
+		n, ok := result.(float64)
+		if !ok {
+			return nil, errors.New("invalid type, must be number")
+		}
+		numbers[i] = n
+	}
+	return numbers, nil
+}
+func JPfSumBy(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	numbers, err := numbersBy(intr, arguments[2].(expRef).ref, arguments[1].([]interface{}))
+	if err != nil {
+		return nil, err
+	}
+	sum := 0.0
+	for _, n := range numbers {
+		sum += n
+	}
+	return sum, nil
+}
+func JPfAvgBy(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	numbers, err := numbersBy(intr, arguments[2].(expRef).ref, arguments[1].([]interface{}))
+	if err != nil {
+		return nil, err
+	}
+	if len(numbers) == 0 {
 		return nil, nil
 	}
-	if len(items) == 1 {
-		return items[0], nil
+	sum := 0.0
+	for _, n := range numbers {
+		sum += n
 	}
-	best := items[0]
-	for _, item := range items[1:] {
-		if item > best {
-			best = item
-		}
+	return sum / float64(len(numbers)), nil
+}
+
+// valueSet is a set of values compared with objsEqual.  Scalars are kept
+// in a map so that looking them up doesn't take longer as the set grows;
+// arrays and objects are compared one by one.
+type valueSet struct {
+	scalars    map[interface{}]bool
+	composites []interface{}
+}
+
+func newValueSet() *valueSet {
+	return &valueSet{scalars: make(map[interface{}]bool)}
+}
+
+// add adds value to the set, reporting whether it wasn't there yet.
+func (s *valueSet) add(value interface{}) bool {
+	if s.contains(value) {
+		return false
+	}
+	if isScalar(value) {
+		s.scalars[value] = true
+	} else {
+		s.composites = append(s.composites, value)
 	}
-	return best, nil
+	return true
 }
-func JPfMerge(arguments []interface{}) (interface{}, error) {
-	final := make(map[string]interface{})
-	for _, m := range arguments {
-		mapped := m.(map[string]interface{})
-		for key, value := range mapped {
-			final[key] = value
+
+func (s *valueSet) contains(value interface{}) bool {
+	if isScalar(value) {
+		return s.scalars[value]
+	}
+	for _, v := range s.composites {
+		if objsEqual(v, value) {
+			return true
 		}
 	}
-	return final, nil
+	return false
 }
-func JPfMaxBy(arguments []interface{}) (interface{}, error) {
+
+// isScalar reports whether value is a JSON null, boolean, number or
+// string, which are equal exactly when they are equal map keys.
+func isScalar(value interface{}) bool {
+	switch value.(type) {
+	case nil, bool, float64, string:
+		return true
+	}
+	return false
+}
+
+func valueSetOf(values []interface{}) *valueSet {
+	set := newValueSet()
+	for _, value := range values {
+		set.add(value)
+	}
+	return set
+}
+func JPfUniqueBy(arguments []interface{}) (interface{}, error) {
 	intr := arguments[0].(*treeInterpreter)
 	arr := arguments[1].([]interface{})
-	exp := arguments[2].(expRef)
-	node := exp.ref
+	node := arguments[2].(expRef).ref
+	seen := newValueSet()
+	collected := []interface{}{}
+	for _, item := range arr {
+		key, err := intr.Execute(node, item)
+		if err != nil {
+			return nil, err
+		}
+		if seen.add(key) {
+			collected = append(collected, item)
+		}
+	}
+	return collected, nil
+}
+func JPfDistinct(arguments []interface{}) (interface{}, error) {
+	seen := newValueSet()
+	collected := []interface{}{}
+	for _, item := range arguments[0].([]interface{}) {
+		if seen.add(item) {
+			collected = append(collected, item)
+		}
+	}
+	return collected, nil
+}
+
+// JPfSlice slices an array with the same rules as the [start:stop:step]
+// slice expression.
+func JPfSlice(arguments []interface{}) (interface{}, error) {
+	parts := make([]sliceParam, 3)
+	for i, arg := range arguments[1:] {
+		n, err := toInteger(arg)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = sliceParam{N: n, Specified: true}
+	}
+	return slice(arguments[0].([]interface{}), parts)
+}
+func flattenDeep(arr []interface{}, flattened []interface{}) []interface{} {
+	for _, element := range arr {
+		if inner, ok := toInterfaceSlice(element); ok {
+			flattened = flattenDeep(inner, flattened)
+		} else {
+			flattened = append(flattened, element)
+		}
+	}
+	return flattened
+}
+func JPfFlattenDeep(arguments []interface{}) (interface{}, error) {
+	return flattenDeep(arguments[0].([]interface{}), []interface{}{}), nil
+}
+func JPfChunk(arguments []interface{}) (interface{}, error) {
+	arr := arguments[0].([]interface{})
+	size, err := toInteger(arguments[1])
+	if err != nil || size < 1 {
+		return nil, errors.New("invalid value, chunk size must be a positive integer")
+	}
+	chunks := []interface{}{}
+	for start := 0; start < len(arr); start += size {
+		end := start + size
+		if end > len(arr) {
+			end = len(arr)
+		}
+		chunk := make([]interface{}, end-start)
+		copy(chunk, arr[start:end])
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+func JPfFirst(arguments []interface{}) (interface{}, error) {
+	arr := arguments[0].([]interface{})
 	if len(arr) == 0 {
 		return nil, nil
-	} else if len(arr) == 1 {
-		return arr[0], nil
 	}
-	start, err := intr.Execute(node, arr[0])
-	if err != nil {
-		return nil, err
+	return arr[0], nil
+}
+func JPfLast(arguments []interface{}) (interface{}, error) {
+	arr := arguments[0].([]interface{})
+	if len(arr) == 0 {
+		return nil, nil
 	}
-	switch t := start.(type) {
-	case float64:
-		bestVal := t
-		bestItem := arr[0]
-		for _, item := range arr[1:] {
-			result, err := intr.Execute(node, item)
-			if err != nil {
-				return nil, err
-			}
-			current, ok := result.(float64)
-			if !ok {
-				return nil, errors.New("invalid type, must be number")
-			}
-			if current > bestVal {
-				bestVal = current
-				bestItem = item
-			}
+	return arr[len(arr)-1], nil
+}
+
+// JPfIndexOf returns the index of the first element equal to the value,
+// or null if there is none.
+func JPfIndexOf(arguments []interface{}) (interface{}, error) {
+	for i, element := range arguments[0].([]interface{}) {
+		if objsEqual(element, arguments[1]) {
+			return float64(i), nil
 		}
-		return bestItem, nil
-	case string:
-		bestVal := t
-		bestItem := arr[0]
-		for _, item := range arr[1:] {
-			result, err := intr.Execute(node, item)
-			if err != nil {
-				return nil, err
-			}
-			current, ok := result.(string)
-			if !ok {
-				return nil, errors.New("invalid type, must be string")
-			}
-			if current > bestVal {
-				bestVal = current
-				bestItem = item
-			}
+	}
+	return nil, nil
+}
+func JPfConcat(arguments []interface{}) (interface{}, error) {
+	collected := []interface{}{}
+	for _, arg := range arguments {
+		collected = append(collected, arg.([]interface{})...)
+	}
+	return collected, nil
+}
+
+// The set functions treat arrays as sets: their results contain each
+// value once, in the order it first appears in the arguments.
+
+func JPfDifference(arguments []interface{}) (interface{}, error) {
+	exclude := valueSetOf(arguments[1].([]interface{}))
+	seen := newValueSet()
+	collected := []interface{}{}
+	for _, element := range arguments[0].([]interface{}) {
+		if !exclude.contains(element) && seen.add(element) {
+			collected = append(collected, element)
 		}
-		return bestItem, nil
-	default:
-		return nil, errors.New("invalid type, must be number of string")
 	}
+	return collected, nil
 }
-func JPfSum(arguments []interface{}) (interface{}, error) {
-	items, _ := toArrayNum(arguments[0])
-	sum := 0.0
-	for _, item := range items {
-		sum += item
+func JPfIntersection(arguments []interface{}) (interface{}, error) {
+	other := valueSetOf(arguments[1].([]interface{}))
+	seen := newValueSet()
+	collected := []interface{}{}
+	for _, element := range arguments[0].([]interface{}) {
+		if other.contains(element) && seen.add(element) {
+			collected = append(collected, element)
+		}
 	}
-	return sum, nil
+	return collected, nil
+}
+func JPfUnion(arguments []interface{}) (interface{}, error) {
+	concatenated, _ := JPfConcat(arguments)
+	return JPfDistinct([]interface{}{concatenated})
 }
 
-func JPfMin(arguments []interface{}) (interface{}, error) {
-	if items, ok := toArrayNum(arguments[0]); ok {
-		if len(items) == 0 {
-			return nil, nil
-		}
-		if len(items) == 1 {
-			return items[0], nil
+// JPfRange returns the integers from start up to, but not including, stop
+// counting by step like Python's range().
+func JPfRange(arguments []interface{}) (interface{}, error) {
+	for _, arg := range arguments {
+		if _, err := toInteger(arg); err != nil {
+			return nil, err
 		}
-		best := items[0]
-		for _, item := range items[1:] {
-			if item < best {
-				best = item
-			}
+	}
+	start, stop := arguments[0].(float64), arguments[1].(float64)
+	step := 1.0
+	if len(arguments) > 2 {
+		step = arguments[2].(float64)
+		if step == 0 {
+			return nil, errors.New("invalid value, step cannot be 0")
 		}
-		return best, nil
 	}
-	items, _ := toArrayStr(arguments[0])
-	if len(items) == 0 {
-		return nil, nil
+	length := math.Ceil((stop - start) / step)
+	if length > maxGeneratedLength {
+		return nil, fmt.Errorf("invalid value, range cannot have more than %d elements", maxGeneratedLength)
 	}
-	if len(items) == 1 {
-		return items[0], nil
+	collected := []interface{}{}
+	for i := 0; float64(i) < length; i++ {
+		collected = append(collected, start+float64(i)*step)
 	}
-	best := items[0]
-	for _, item := range items[1:] {
-		if item < best {
-			best = item
+	return collected, nil
+}
+
+// The object functions below never modify their arguments, they build new
+// objects that share unmodified values with the input.
+
+// deepMerge merges the objects in order, recursively merging the values of
+// keys that are objects in both.  Any other value replaces the earlier one.
+func (intr *treeInterpreter) deepMerge(objects []interface{}) interface{} {
+	merged := NewOrderedMap()
+	for _, m := range objects {
+		for _, key := range objectKeys(m, true) {
+			value := objectGet(m, key)
+			if previous, ok := merged.Get(key); ok && isObject(previous) && isObject(value) {
+				value = intr.deepMerge([]interface{}{previous, value})
+			}
+			merged.Set(key, value)
 		}
 	}
-	return best, nil
+	return intr.buildObject(merged)
 }
-
-func JPfMinBy(arguments []interface{}) (interface{}, error) {
+func JPfDeepMerge(arguments []interface{}) (interface{}, error) {
 	intr := arguments[0].(*treeInterpreter)
-	arr := arguments[1].([]interface{})
-	exp := arguments[2].(expRef)
-	node := exp.ref
-	if len(arr) == 0 {
-		return nil, nil
-	} else if len(arr) == 1 {
-		return arr[0], nil
-	}
-	start, err := intr.Execute(node, arr[0])
-	if err != nil {
-		return nil, err
+	return intr.deepMerge(arguments[1:]), nil
+}
+
+// filterKeys returns a copy of obj with only the keys for which keep
+// returns true.
+func (intr *treeInterpreter) filterKeys(obj interface{}, keep func(string) bool) interface{} {
+	filtered := NewOrderedMap()
+	for _, key := range objectKeys(obj, true) {
+		if keep(key) {
+			filtered.Set(key, objectGet(obj, key))
+		}
 	}
-	if t, ok := start.(float64); ok {
-		bestVal := t
-		bestItem := arr[0]
-		for _, item := range arr[1:] {
-			result, err := intr.Execute(node, item)
-			if err != nil {
-				return nil, err
-			}
-			current, ok := result.(float64)
-			if !ok {
-				return nil, errors.New("invalid type, must be number")
-			}
-			if current < bestVal {
-				bestVal = current
-				bestItem = item
+	return intr.buildObject(filtered)
+}
+func JPfPick(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	keys, _ := toArrayStr(arguments[2])
+	return intr.filterKeys(arguments[1], func(key string) bool {
+		for _, k := range keys {
+			if k == key {
+				return true
 			}
 		}
-		return bestItem, nil
-	} else if t, ok := start.(string); ok {
-		bestVal := t
-		bestItem := arr[0]
-		for _, item := range arr[1:] {
-			result, err := intr.Execute(node, item)
-			if err != nil {
-				return nil, err
-			}
-			current, ok := result.(string)
-			if !ok {
-				return nil, errors.New("invalid type, must be string")
+		return false
+	}), nil
+}
+func JPfOmit(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	keys, _ := toArrayStr(arguments[2])
+	return intr.filterKeys(arguments[1], func(key string) bool {
+		for _, k := range keys {
+			if k == key {
+				return false
 			}
-			if current < bestVal {
-				bestVal = current
-				bestItem = item
+		}
+		return true
+	}), nil
+}
+
+// JPfRenameKeys renames the keys of an object according to a mapping of
+// old to new names.  Keys missing from the mapping are kept as they are.
+// Renaming a key to the name of another key is an error rather than
+// silently dropping one of the values.
+func JPfRenameKeys(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	obj := arguments[1]
+	mapping := arguments[2]
+	renamed := NewOrderedMap()
+	for _, key := range objectKeys(obj, true) {
+		name := key
+		if newName, ok := objectLookup(mapping, key); ok {
+			if name, ok = newName.(string); !ok {
+				return nil, fmt.Errorf("invalid value, new name for %q must be a string", key)
 			}
 		}
-		return bestItem, nil
-	} else {
-		return nil, errors.New("invalid type, must be number of string")
+		if _, exists := renamed.Get(name); exists {
+			return nil, fmt.Errorf("invalid value, renaming %q would overwrite the key %q", key, name)
+		}
+		renamed.Set(name, objectGet(obj, key))
 	}
+	return intr.buildObject(renamed), nil
 }
-func JPfType(arguments []interface{}) (interface{}, error) {
-	arg := arguments[0]
-	if _, ok := arg.(float64); ok {
-		return "number", nil
+
+// JPfGet evaluates a JMESPath expression given as a string against an
+// object, returning the default if the result is null.
+func JPfGet(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	node, err := intr.parsePath(arguments[2].(string))
+	if err != nil {
+		return nil, err
 	}
-	if _, ok := arg.(string); ok {
-		return "string", nil
+	result, err := intr.Execute(node, arguments[1])
+	if err != nil {
+		return nil, err
 	}
-	if _, ok := arg.([]interface{}); ok {
-		return "array", nil
+	if result == nil && len(arguments) > 3 {
+		return arguments[3], nil
 	}
-	if _, ok := arg.(map[string]interface{}); ok {
-		return "object", nil
+	return result, nil
+}
+func JPfSet(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	obj := arguments[1]
+	updated := NewOrderedMap()
+	for _, key := range objectKeys(obj, true) {
+		updated.Set(key, objectGet(obj, key))
 	}
-	if arg == nil {
-		return "null", nil
+	updated.Set(arguments[2].(string), arguments[3])
+	return intr.buildObject(updated), nil
+}
+func JPfBase64Encode(arguments []interface{}) (interface{}, error) {
+	return base64.StdEncoding.EncodeToString([]byte(arguments[0].(string))), nil
+}
+
+// JPfBase64Decode decodes standard base64, with or without padding.  The
+// decoded bytes must be valid UTF-8, since JSON can't represent anything
+// else as a string.
+func JPfBase64Decode(arguments []interface{}) (interface{}, error) {
+	encoded := strings.TrimRight(arguments[0].(string), "=")
+	decoded, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
 	}
-	if arg == true || arg == false {
-		return "boolean", nil
+	if !utf8.Valid(decoded) {
+		return nil, errors.New("invalid value, decoded data is not valid UTF-8")
 	}
-	return nil, errors.New("unknown type")
+	return string(decoded), nil
 }
-func JPfKeys(arguments []interface{}) (interface{}, error) {
-	arg := arguments[0].(map[string]interface{})
-	collected := make([]interface{}, 0, len(arg))
-	for key := range arg {
-		collected = append(collected, key)
+
+// JPfURLEncode escapes a string so it can be used as a URL query
+// parameter.
+func JPfURLEncode(arguments []interface{}) (interface{}, error) {
+	return url.QueryEscape(arguments[0].(string)), nil
+}
+func JPfURLDecode(arguments []interface{}) (interface{}, error) {
+	return url.QueryUnescape(arguments[0].(string))
+}
+func JPfHexEncode(arguments []interface{}) (interface{}, error) {
+	return hex.EncodeToString([]byte(arguments[0].(string))), nil
+}
+func JPfSHA256(arguments []interface{}) (interface{}, error) {
+	sum := sha256.Sum256([]byte(arguments[0].(string)))
+	return hex.EncodeToString(sum[:]), nil
+}
+func JPfMD5(arguments []interface{}) (interface{}, error) {
+	sum := md5.Sum([]byte(arguments[0].(string)))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// uuidNamespaces are the name spaces predefined by RFC 4122, which uuid_v5
+// accepts by name as well.
+var uuidNamespaces = map[string]string{
+	"dns":  "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+	"url":  "6ba7b811-9dad-11d1-80b4-00c04fd430c8",
+	"oid":  "6ba7b812-9dad-11d1-80b4-00c04fd430c8",
+	"x500": "6ba7b814-9dad-11d1-80b4-00c04fd430c8",
+}
+
+func parseUUID(s string) ([]byte, error) {
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return nil, fmt.Errorf("invalid UUID %q", s)
 	}
-	return collected, nil
+	uuid, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid UUID %q", s)
+	}
+	return uuid, nil
 }
-func JPfValues(arguments []interface{}) (interface{}, error) {
-	arg := arguments[0].(map[string]interface{})
-	collected := make([]interface{}, 0, len(arg))
-	for _, value := range arg {
-		collected = append(collected, value)
+
+// JPfUUIDv5 returns the RFC 4122 version 5 UUID of a name within a name
+// space, which is either a UUID or one of "dns", "url", "oid" and "x500".
+func JPfUUIDv5(arguments []interface{}) (interface{}, error) {
+	namespace := arguments[0].(string)
+	if predefined, ok := uuidNamespaces[strings.ToLower(namespace)]; ok {
+		namespace = predefined
+	}
+	ns, err := parseUUID(namespace)
+	if err != nil {
+		return nil, err
 	}
-	return collected, nil
+	h := sha1.New()
+	h.Write(ns)
+	h.Write([]byte(arguments[1].(string)))
+	uuid := h.Sum(nil)[:16]
+	uuid[6] = uuid[6]&0x0f | 0x50
+	uuid[8] = uuid[8]&0x3f | 0x80
+	encoded := hex.EncodeToString(uuid)
+	return encoded[:8] + "-" + encoded[8:12] + "-" + encoded[12:16] + "-" + encoded[16:20] + "-" + encoded[20:], nil
 }
-func JPfSort(arguments []interface{}) (interface{}, error) {
-	if items, ok := toArrayNum(arguments[0]); ok {
-		d := sort.Float64Slice(items)
-		sort.Stable(d)
-		final := make([]interface{}, len(d))
-		for i, val := range d {
-			final[i] = val
-		}
-		return final, nil
+func JPfHTMLEscape(arguments []interface{}) (interface{}, error) {
+	return html.EscapeString(arguments[0].(string)), nil
+}
+
+func parseIP(s string) (net.IP, error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", s)
 	}
-	// Otherwise we're dealing with sort()'ing strings.
-	items, _ := toArrayStr(arguments[0])
-	d := sort.StringSlice(items)
-	sort.Stable(d)
-	final := make([]interface{}, len(d))
-	for i, val := range d {
-		final[i] = val
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4, nil
 	}
-	return final, nil
+	return ip, nil
 }
-func JPfSortBy(arguments []interface{}) (interface{}, error) {
-	intr := arguments[0].(*treeInterpreter)
-	arr := arguments[1].([]interface{})
-	exp := arguments[2].(expRef)
-	node := exp.ref
-	if len(arr) == 0 {
-		return arr, nil
-	} else if len(arr) == 1 {
-		return arr, nil
+
+// parseNetwork parses a CIDR block, or a single IP address which is
+// treated as a network containing only that address.
+func parseNetwork(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip, err := parseIP(s)
+		if err != nil {
+			return nil, err
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}, nil
 	}
-	start, err := intr.Execute(node, arr[0])
+	_, network, err := net.ParseCIDR(s)
 	if err != nil {
 		return nil, err
 	}
-	if _, ok := start.(float64); ok {
-		sortable := &byExprFloat{intr, node, arr, false}
-		sort.Stable(sortable)
-		if sortable.hasError {
-			return nil, errors.New("error in sort_by comparison")
-		}
-		return arr, nil
-	} else if _, ok := start.(string); ok {
-		sortable := &byExprString{intr, node, arr, false}
-		sort.Stable(sortable)
-		if sortable.hasError {
-			return nil, errors.New("error in sort_by comparison")
-		}
-		return arr, nil
-	} else {
-		return nil, errors.New("invalid type, must be number of string")
-	}
+	return network, nil
 }
-func JPfJoin(arguments []interface{}) (interface{}, error) {
-	sep := arguments[0].(string)
-	// We can't just do arguments[1].([]string), we have to
-	// manually convert each item to a string.
-	arrayStr := []string{}
-	for _, item := range arguments[1].([]interface{}) {
-		arrayStr = append(arrayStr, item.(string))
+func JPfIPInCIDR(arguments []interface{}) (interface{}, error) {
+	ip, err := parseIP(arguments[0].(string))
+	if err != nil {
+		return nil, err
 	}
-	return strings.Join(arrayStr, sep), nil
+	_, network, err := net.ParseCIDR(arguments[1].(string))
+	if err != nil {
+		return nil, err
+	}
+	return len(ip) == len(network.IP) && network.Contains(ip), nil
 }
-func JPfReverse(arguments []interface{}) (interface{}, error) {
-	if s, ok := arguments[0].(string); ok {
-		r := []rune(s)
-		for i, j := 0, len(r)-1; i < len(r)/2; i, j = i+1, j-1 {
-			r[i], r[j] = r[j], r[i]
-		}
-		return string(r), nil
+
+// JPfIPVersion returns 4 or 6, or null if the string is not an IP address.
+// IPv4-mapped IPv6 addresses such as "::ffff:10.0.0.1" are version 4.
+func JPfIPVersion(arguments []interface{}) (interface{}, error) {
+	ip, err := parseIP(arguments[0].(string))
+	if err != nil {
+		return nil, nil
 	}
-	items := arguments[0].([]interface{})
-	length := len(items)
-	reversed := make([]interface{}, length)
-	for i, item := range items {
-		reversed[length-(i+1)] = item
+	if len(ip) == net.IPv4len {
+		return 4.0, nil
 	}
-	return reversed, nil
+	return 6.0, nil
 }
-func JPfToArray(arguments []interface{}) (interface{}, error) {
-	if _, ok := arguments[0].([]interface{}); ok {
-		return arguments[0], nil
+
+// JPfCIDRContains reports whether the first network contains every address
+// of the second one, which can also be a single IP address.
+func JPfCIDRContains(arguments []interface{}) (interface{}, error) {
+	outer, err := parseNetwork(arguments[0].(string))
+	if err != nil {
+		return nil, err
 	}
-	return arguments[:1:1], nil
-}
-func JPfToString(arguments []interface{}) (interface{}, error) {
-	if v, ok := arguments[0].(string); ok {
-		return v, nil
+	inner, err := parseNetwork(arguments[1].(string))
+	if err != nil {
+		return nil, err
 	}
-	result, err := json.Marshal(arguments[0])
+	outerOnes, outerBits := outer.Mask.Size()
+	innerOnes, innerBits := inner.Mask.Size()
+	return outerBits == innerBits && outerOnes <= innerOnes && outer.Contains(inner.IP), nil
+}
+
+// privateNetworks are the private address ranges of RFC 1918 and the
+// unique local addresses of RFC 4193.
+var privateNetworks = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}
+
+func JPfIsPrivateIP(arguments []interface{}) (interface{}, error) {
+	ip, err := parseIP(arguments[0].(string))
 	if err != nil {
 		return nil, err
 	}
-	return string(result), nil
+	for _, cidr := range privateNetworks {
+		_, network, _ := net.ParseCIDR(cidr)
+		if network.Contains(ip) {
+			return true, nil
+		}
+	}
+	return false, nil
 }
-func JPfToNumber(arguments []interface{}) (interface{}, error) {
-	arg := arguments[0]
-	if v, ok := arg.(float64); ok {
-		return v, nil
+
+// JPfParseURL splits a URL into an object with its scheme, host, port,
+// path, query and fragment.  The port is null if the URL doesn't specify
+// one, and query maps each parameter to its first value.
+func JPfParseURL(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	u, err := url.Parse(arguments[1].(string))
+	if err != nil {
+		return nil, err
 	}
-	if v, ok := arg.(string); ok {
-		conv, err := strconv.ParseFloat(v, 64)
+	var port interface{}
+	if p := u.Port(); p != "" {
+		n, err := strconv.Atoi(p)
 		if err != nil {
-			return nil, nil
+			return nil, fmt.Errorf("invalid port %q", p)
 		}
-		return conv, nil
+		port = float64(n)
 	}
-	if _, ok := arg.([]interface{}); ok {
-		return nil, nil
+	params, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, err
 	}
-	if _, ok := arg.(map[string]interface{}); ok {
-		return nil, nil
+	query := NewOrderedMap()
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		query.Set(name, params[name][0])
+	}
+	parsed := NewOrderedMap()
+	parsed.Set("scheme", u.Scheme)
+	parsed.Set("host", u.Hostname())
+	parsed.Set("port", port)
+	parsed.Set("path", u.Path)
+	parsed.Set("query", intr.buildObject(query))
+	parsed.Set("fragment", u.Fragment)
+	return intr.buildObject(parsed), nil
+}
+func JPfSemverCompare(arguments []interface{}) (interface{}, error) {
+	a, err := parseSemver(arguments[0].(string))
+	if err != nil {
+		return nil, err
 	}
-	if arg == nil {
-		return nil, nil
+	b, err := parseSemver(arguments[1].(string))
+	if err != nil {
+		return nil, err
 	}
-	if arg == true || arg == false {
+	return float64(a.compare(b)), nil
+}
+func JPfSemverSatisfies(arguments []interface{}) (interface{}, error) {
+	version, err := parseSemver(arguments[0].(string))
+	if err != nil {
+		return nil, err
+	}
+	return version.satisfies(arguments[1].(string))
+}
+
+// JPfSemverParse returns the parts of a version as an object, or null if
+// the string is not a valid version.
+func JPfSemverParse(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	version, err := parseSemver(arguments[1].(string))
+	if err != nil {
 		return nil, nil
 	}
-	return nil, errors.New("unknown type")
+	prerelease := make([]interface{}, len(version.prerelease))
+	for i, identifier := range version.prerelease {
+		prerelease[i] = identifier
+	}
+	var build interface{}
+	if version.build != "" {
+		build = version.build
+	}
+	parsed := NewOrderedMap()
+	parsed.Set("major", float64(version.major))
+	parsed.Set("minor", float64(version.minor))
+	parsed.Set("patch", float64(version.patch))
+	parsed.Set("prerelease", prerelease)
+	parsed.Set("build", build)
+	return intr.buildObject(parsed), nil
 }
-func JPfNotNull(arguments []interface{}) (interface{}, error) {
-	for _, arg := range arguments {
-		if arg != nil {
-			return arg, nil
-		}
+
+// JPfSemverKey returns a string that sorts like the version, for use with
+// sort_by, min_by and max_by, as in sort_by(releases, &semver_key(version)).
+func JPfSemverKey(arguments []interface{}) (interface{}, error) {
+	version, err := parseSemver(arguments[0].(string))
+	if err != nil {
+		return nil, err
 	}
-	return nil, nil
+	return version.key(), nil
+}
+
+// JPfSortCI sorts strings ignoring case, using the configured collation
+// otherwise.
+func JPfSortCI(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	items, _ := toArrayStr(arguments[1])
+	collation := intr.opts.Collation
+	collation.IgnoreCase = true
+	return sortStrings(items, collation), nil
+}
+
+// JPfEqualsCI reports whether two strings are equal ignoring case.  It
+// uses full Unicode case folding, so "STRASSE" equals "straße", and the
+// configured normalization form.
+func JPfEqualsCI(arguments []interface{}) (interface{}, error) {
+	intr := arguments[0].(*treeInterpreter)
+	collation := Collation{IgnoreCase: true, Normalization: intr.opts.Collation.Normalization}
+	return collation.key(arguments[1].(string)) == collation.key(arguments[2].(string)), nil
+}
+
+var normalizationForms = map[string]norm.Form{
+	"NFC":  norm.NFC,
+	"NFD":  norm.NFD,
+	"NFKC": norm.NFKC,
+	"NFKD": norm.NFKD,
+}
+
+// JPfNormalize converts a string to the Unicode normalization form NFC,
+// NFD, NFKC or NFKD, which defaults to NFC.
+func JPfNormalize(arguments []interface{}) (interface{}, error) {
+	form := "NFC"
+	if len(arguments) > 1 {
+		form = strings.ToUpper(arguments[1].(string))
+	}
+	f, ok := normalizationForms[form]
+	if !ok {
+		return nil, fmt.Errorf("invalid normalization form %q, expected NFC, NFD, NFKC or NFKD", arguments[1])
+	}
+	return f.String(arguments[0].(string)), nil
 }
@@ -0,0 +1,826 @@
+package jmespath
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jmespath/go-jmespath/internal/testify/assert"
+)
+
+type functionTestCase struct {
+	expression string
+	expected   interface{}
+}
+
+var functionsFixture = []byte(`{
+	"log": "2024-01-02 ERROR disk full; 2024-01-03 WARN disk slow",
+	"csv": "a, b,c ,d"
+}`)
+
+func runFunctionTests(t *testing.T, fixture []byte, cases []functionTestCase) {
+	var data interface{}
+	assert.Nil(t, json.Unmarshal(fixture, &data))
+	runFunctionTestsOn(t, data, cases)
+}
+
+func runFunctionTestsOn(t *testing.T, data interface{}, cases []functionTestCase) {
+	assert := assert.New(t)
+	for _, tt := range cases {
+		result, err := Search(tt.expression, data)
+		if assert.Nil(err, tt.expression) {
+			assert.Equal(tt.expected, result, fmt.Sprintf("Expression: %s", tt.expression))
+		}
+	}
+}
+
+func runFunctionErrorTests(t *testing.T, expressions []string) {
+	assert := assert.New(t)
+	for _, expression := range expressions {
+		_, err := Search(expression, nil)
+		assert.NotNil(err, expression)
+	}
+}
+
+func TestRegexFunctions(t *testing.T) {
+	runFunctionTests(t, functionsFixture, []functionTestCase{
+		{`regex_match(log, 'ERROR|FATAL')`, true},
+		{`regex_match(log, '^WARN')`, false},
+		{`regex_find_first(log, '\d{4}-\d{2}-\d{2}')`, "2024-01-02"},
+		{`regex_find_first(log, 'FATAL')`, nil},
+		{`regex_find_all(log, '[A-Z]{4,}')`, []interface{}{"ERROR", "WARN"}},
+		{`regex_find_all(log, 'FATAL')`, []interface{}{}},
+		{`regex_replace(log, '(\d{4})-(\d{2})-(\d{2})', '$3/$2/$1')`, "02/01/2024 ERROR disk full; 03/01/2024 WARN disk slow"},
+		{`regex_split(csv, '\s*,\s*')`, []interface{}{"a", "b", "c", "d"}},
+		{`match(log, 'ERROR|FATAL')`, true},
+		{`find_all(log, '[A-Z]{4,}')`, []interface{}{"ERROR", "WARN"}},
+	})
+	runFunctionErrorTests(t, []string{
+		`regex_match('abc', '(')`,
+		`regex_match('abc')`,
+		"regex_find_all(`1`, 'a')",
+	})
+}
+
+func TestRegexpsAreCompiledOnce(t *testing.T) {
+	assert := assert.New(t)
+	// Only valid literal patterns are compiled in advance.
+	jp := MustCompile(`[match(@, '^a'), find_all(@, '('), regex_split(@, pattern)]`)
+	assert.Len(jp.intr.regexps, 1)
+	assert.NotNil(jp.intr.regexps["^a"])
+	jp = MustCompile(`[?match(@, '^a')]`)
+	result, err := jp.Search([]interface{}{"ab", "ba", "ac"})
+	assert.Nil(err)
+	assert.Equal([]interface{}{"ab", "ac"}, result)
+	// Patterns taken from the data aren't cached.
+	jp = MustCompile(`[?match(name, pattern)].name`)
+	result, err = jp.Search([]interface{}{
+		map[string]interface{}{"name": "ab", "pattern": "^a"},
+		map[string]interface{}{"name": "ba", "pattern": "^a"},
+		map[string]interface{}{"name": "bc", "pattern": "c$"},
+	})
+	assert.Nil(err)
+	assert.Equal([]interface{}{"ab", "bc"}, result)
+	assert.Len(jp.intr.regexps, 0)
+}
+
+func TestGetPathsAreParsedOnce(t *testing.T) {
+	assert := assert.New(t)
+	// Only valid literal paths are parsed in advance.
+	jp := MustCompile(`[get(@, 'a.b'), get(@, 'a.['), get(@, path)]`)
+	assert.Len(jp.intr.paths, 1)
+	_, err := jp.Search(map[string]interface{}{
+		"a":    map[string]interface{}{"b": 1.0},
+		"path": "a",
+	})
+	assert.NotNil(err)
+	jp = MustCompile(`[get(@, 'a.b'), get(@, path)]`)
+	result, err := jp.Search(map[string]interface{}{
+		"a":    map[string]interface{}{"b": 1.0},
+		"path": "a.b",
+	})
+	assert.Nil(err)
+	assert.Equal([]interface{}{1.0, 1.0}, result)
+	assert.Len(jp.intr.paths, 1)
+}
+
+func TestStringFunctions(t *testing.T) {
+	runFunctionTests(t, []byte(`{"name": "  Ünïcode Straße  ", "path": "a/b/c"}`), []functionTestCase{
+		{`lower('MiXeD')`, "mixed"},
+		{`upper('ünïcode')`, "ÜNÏCODE"},
+		{`trim(name)`, "Ünïcode Straße"},
+		{`trim_left(name)`, "Ünïcode Straße  "},
+		{`trim_right(name)`, "  Ünïcode Straße"},
+		{`trim('xxhixx', 'x')`, "hi"},
+		{`trim_left('--a--', '-')`, "a--"},
+		{`trim_right('--a--', '-')`, "--a"},
+		{`split(path, '/')`, []interface{}{"a", "b", "c"}},
+		{"split(path, '/', `1`)", []interface{}{"a", "b/c"}},
+		{"split(path, '/', `0`)", []interface{}{"a/b/c"}},
+		{`split('abc', '')`, []interface{}{"a", "b", "c"}},
+		{`replace(path, '/', '.')`, "a.b.c"},
+		{"replace(path, '/', '.', `1`)", "a.b/c"},
+		{"pad_left('7', `3`, '0')", "007"},
+		{"pad_right('ab', `4`)", "ab  "},
+		{"pad_left('abcd', `2`)", "abcd"},
+		{"pad_right('é', `3`, 'ß')", "éßß"},
+		{"substr(trim(name), `0`, `7`)", "Ünïcode"},
+		{"substr(trim(name), `-6`)", "Straße"},
+		{"substr('abc', `5`)", ""},
+		{"substr('abc', `1e19`)", ""},
+		{"substr('abc', `-1e19`, `1e19`)", "abc"},
+		{"find_first(pad_left('x', `2001`), 'x', `2000`, `1e19`)", 2000.0},
+		{"find_last('abcb', 'b', `-1e19`)", 3.0},
+		{"split(path, '/', `1e19`)", []interface{}{"a", "b", "c"}},
+		{"replace('aaa', 'a', 'b', `1e19`)", "bbb"},
+		{"round(`1.5`, `1e19`)", 1.5},
+		{"length(substr(pad_left('', `2000`), `1500`, `9223372036854774784`))", 500.0},
+		{"find_first(path, '/')", 1.0},
+		{"find_last(path, '/')", 3.0},
+		{"find_first(path, '/', `2`)", 3.0},
+		{"find_first(path, '/', `0`, `1`)", nil},
+		{"find_first(path, 'x')", nil},
+		{"find_first('Straße b', 'b')", 7.0},
+		{"find_last('abc', '')", 3.0},
+		{"find_first('abc', '', `-1`)", 2.0},
+	})
+	runFunctionErrorTests(t, []string{
+		"split('a', 'b', `1.5`)",
+		"split('a', 'b', `-1`)",
+		"pad_left('a', `3`, 'ab')",
+		"pad_left('a', `-1`)",
+		"pad_left('', `1e10`)",
+		"pad_right('a', `2000000`, '-')",
+		"substr('abc', `0.5`)",
+		"substr('abc', `0`, `-1`)",
+		"find_first('abc', 'a', `0`, `1`, `2`)",
+		"upper(`1`)",
+		"trim()",
+	})
+}
+
+func TestDateFunctions(t *testing.T) {
+	runFunctionTests(t, []byte(`{"created": "2024-03-10T15:04:05.5+02:00", "epoch": 1710075845.5}`), []functionTestCase{
+		{`to_epoch(created)`, 1710075845.5},
+		{`to_epoch('2024-01-02', '2006-01-02')`, 1704153600.0},
+		{`from_epoch(epoch)`, "2024-03-10T13:04:05.5Z"},
+		{"from_epoch(`0`, '2006-01-02 15:04')", "1970-01-01 00:00"},
+		{"date_add(epoch, `-1.5`, 'hours')", 1710070445.5},
+		{"date_add(created, `1`, 'day')", "2024-03-11T15:04:05.5+02:00"},
+		{"date_add('2024-01-31T00:00:00Z', `1`, 'month')", "2024-03-02T00:00:00Z"},
+		{"date_add('2024-02-29T00:00:00Z', `1`, 'year')", "2025-03-01T00:00:00Z"},
+		{"date_add('2024-01-01T00:00:00Z', `7975`, 'years')", "9999-01-01T00:00:00Z"},
+		{"date_diff(epoch, to_epoch(created))", 0.0},
+		{"date_diff('2024-03-11T00:00:00Z', '2024-03-10T12:00:00Z', 'days')", 0.5},
+		{"date_diff('2024-01-01T00:00:00Z', '2024-03-11T00:00:00Z', 'week')", -10.0},
+		{"date_diff('2024-03-09T00:00:00Z', '2024-01-10T00:00:00Z', 'months')", 1.0},
+		{"date_diff('2024-03-10T00:00:00Z', '2024-01-10T00:00:00Z', 'months')", 2.0},
+		{"date_diff('2024-01-10T00:00:00Z', '2024-03-10T00:00:00Z', 'month')", -2.0},
+		{"date_diff('2025-03-09T00:00:00Z', '2024-03-10T00:00:00Z', 'year')", 0.0},
+		{"date_trunc(created, 'hour')", "2024-03-10T15:00:00+02:00"},
+		{"date_trunc(created, 'day')", "2024-03-10T00:00:00+02:00"},
+		{"date_trunc(created, 'week')", "2024-03-04T00:00:00+02:00"},
+		{"date_trunc(created, 'month')", "2024-03-01T00:00:00+02:00"},
+		{"date_trunc(epoch, 'year')", 1704067200.0},
+	})
+	runFunctionErrorTests(t, []string{
+		`to_epoch('yesterday')`,
+		"date_add(`0`, `1`, 'fortnight')",
+		"date_add(`0`, `0.5`, 'month')",
+		"date_add(`0`, `1e300`, 'second')",
+		"date_add(`0`, `-1e300`, 'weeks')",
+		"date_add(`0`, `1e19`, 'month')",
+		"date_add(`0`, `-1e19`, 'years')",
+		"date_add('9999-12-31T00:00:00Z', `1`, 'day')",
+		"date_add(`0`, `-2000`, 'years')",
+		"from_epoch(`1e300`)",
+		"from_epoch(`-1e300`)",
+		"date_trunc(`1e18`, 'day')",
+		"date_trunc('2024-03-10', 'day')",
+		"now(`1`)",
+	})
+}
+
+func TestNowUsesClock(t *testing.T) {
+	assert := assert.New(t)
+	jp, err := Compile("items[?date_diff(now(), created, 'days') <= `7`].id")
+	assert.Nil(err)
+	jp.SetOptions(Options{Clock: func() time.Time {
+		return time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	}})
+	data := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"id": "old", "created": "2024-02-01T00:00:00Z"},
+			map[string]interface{}{"id": "new", "created": "2024-03-05T09:30:00+01:00"},
+		},
+	}
+	result, err := jp.Search(data)
+	assert.Nil(err)
+	assert.Equal([]interface{}{"new"}, result)
+
+	result, err = Search("now()", nil)
+	assert.Nil(err)
+	assert.InDelta(float64(time.Now().Unix()), result, 5)
+}
+
+func TestObjectConstructionFunctions(t *testing.T) {
+	runFunctionTests(t, []byte(`{"labels": {"app": "web", "tier": "frontend"}, "names": ["a", "b", "c"], "ids": [1, 2]}`), []functionTestCase{
+		{`sort_by(items(labels), &[0])`, []interface{}{
+			[]interface{}{"app", "web"},
+			[]interface{}{"tier", "frontend"},
+		}},
+		{"items(`{}`)", []interface{}{}},
+		{`from_items(items(labels))`, map[string]interface{}{"app": "web", "tier": "frontend"}},
+		{`from_items(items(labels)[?[0] != 'tier'])`, map[string]interface{}{"app": "web"}},
+		{`from_items(items(labels)[*].[join('/', ['k8s', [0]]), [1]])`, map[string]interface{}{"k8s/app": "web", "k8s/tier": "frontend"}},
+		{"from_items(`[[\"a\", 1], [\"a\", 2]]`)", map[string]interface{}{"a": 2.0}},
+		{"from_items(`[]`)", map[string]interface{}{}},
+		{`zip(names, ids)`, []interface{}{
+			[]interface{}{"a", 1.0},
+			[]interface{}{"b", 2.0},
+		}},
+		{`zip(names)`, []interface{}{
+			[]interface{}{"a"},
+			[]interface{}{"b"},
+			[]interface{}{"c"},
+		}},
+		{"zip(names, `[]`)", []interface{}{}},
+		{`from_items(zip(names, ids))`, map[string]interface{}{"a": 1.0, "b": 2.0}},
+	})
+	runFunctionErrorTests(t, []string{
+		"items(`[]`)",
+		"from_items(`[[\"a\"]]`)",
+		"from_items(`[[1, 2]]`)",
+		"from_items(`[\"ab\"]`)",
+		"zip()",
+		"zip(`[]`, `{}`)",
+	})
+}
+
+// typedSlices holds slices that weren't decoded from JSON, like the
+// []string field of a struct, which functions taking an array accept too.
+var typedSlices = map[string]interface{}{
+	"names":  []string{"b", "a", "c"},
+	"ids":    []float64{1, 2},
+	"pairs":  [][]string{{"a", "x"}, {"b", "y"}},
+	"nested": []interface{}{[]string{"a"}, [][]float64{{1}, {2, 3}}},
+	"orders": []map[string]interface{}{
+		{"id": 1.0, "region": "eu", "tags": []string{"new"}},
+		{"id": 2.0, "region": "us", "tags": []string{}},
+		{"id": 3.0, "region": "eu", "tags": []string{"gift", "new"}},
+	},
+}
+
+func TestTypedSliceArguments(t *testing.T) {
+	runFunctionTestsOn(t, typedSlices, []functionTestCase{
+		{`zip(names, ids)`, []interface{}{
+			[]interface{}{"b", 1.0},
+			[]interface{}{"a", 2.0},
+		}},
+		{`from_items(pairs)`, map[string]interface{}{"a": "x", "b": "y"}},
+		{`from_items(zip(names, ids))`, map[string]interface{}{"b": 1.0, "a": 2.0}},
+		{`group_by(orders, &region).eu[*].id`, []interface{}{1.0, 3.0}},
+		{`count_by(orders, &region)`, map[string]interface{}{"eu": 2.0, "us": 1.0}},
+		{`sum_by(orders, &id)`, 6.0},
+		{`avg_by(orders, &id)`, 2.0},
+		{`unique_by(orders, &region)[*].id`, []interface{}{1.0, 2.0}},
+		{`first(names)`, "b"},
+		{`last(ids)`, 2.0},
+		{`index_of(names, 'c')`, 2.0},
+		{"chunk(names, `2`)", []interface{}{[]interface{}{"b", "a"}, []interface{}{"c"}}},
+		{`concat(names, ids)`, []interface{}{"b", "a", "c", 1.0, 2.0}},
+		{`unique(concat(names, names))`, []interface{}{"b", "a", "c"}},
+		{`flatten_deep(nested)`, []interface{}{"a", 1.0, 2.0, 3.0}},
+		{"slice(names, `1`)", []interface{}{"a", "c"}},
+		{`difference(names, pairs[0])`, []interface{}{"b", "c"}},
+		{`intersection(names, pairs[1])`, []interface{}{"b"}},
+		{`union(names, pairs[0])`, []interface{}{"b", "a", "c", "x"}},
+		{"filter(&id > `1`, orders)[*].id", []interface{}{2.0, 3.0}},
+		{"reduce(&sum([accumulated, current]), ids, `0`)", 3.0},
+		{"any(&@ == 'c', names)", true},
+		{"all(&length(@) == `1`, names)", true},
+		{"find(&region == 'us', orders).id", 2.0},
+		{"find_index(&@ == 'a', names)", 1.0},
+		{"flat_map(&tags, orders)", []interface{}{"new", "gift", "new"}},
+	})
+}
+
+func TestItemsPreserveOrder(t *testing.T) {
+	assert := assert.New(t)
+	data, err := UnmarshalOrdered([]byte(`{"z": 1, "a": 2, "m": 3}`))
+	assert.Nil(err)
+	jp, err := Compile("from_items(items(@)[?[1] > `1`])")
+	assert.Nil(err)
+	jp.SetOptions(Options{PreserveOrder: true})
+	result, err := jp.Search(data)
+	assert.Nil(err)
+	encoded, err := json.Marshal(result)
+	assert.Nil(err)
+	assert.Equal(`{"a":2,"m":3}`, string(encoded))
+}
+
+var ordersFixture = []byte(`{"orders": [
+	{"id": 1, "region": "eu", "total": 10, "customer": {"name": "ann"}},
+	{"id": 2, "region": "us", "total": 25, "customer": {"name": "bob"}},
+	{"id": 3, "region": "eu", "total": 5, "customer": {"name": "ann"}},
+	{"id": 4, "region": null, "total": 1, "customer": {"name": "cid"}}
+]}`)
+
+func TestAggregationFunctions(t *testing.T) {
+	runFunctionTests(t, ordersFixture, []functionTestCase{
+		{`group_by(orders, &region).eu[*].id`, []interface{}{1.0, 3.0}},
+		{`sort(keys(group_by(orders, &region)))`, []interface{}{"eu", "us"}},
+		{`count_by(orders, &region)`, map[string]interface{}{"eu": 2.0, "us": 1.0}},
+		{`count_by(orders, &customer.name)`, map[string]interface{}{"ann": 2.0, "bob": 1.0, "cid": 1.0}},
+		{`sum_by(orders, &total)`, 41.0},
+		{`sum_by(orders[?region=='eu'], &total)`, 15.0},
+		{`avg_by(orders, &total)`, 10.25},
+		{"sum_by(`[]`, &total)", 0.0},
+		{"avg_by(`[]`, &total)", nil},
+		{`unique_by(orders, &customer.name)[*].id`, []interface{}{1.0, 2.0, 4.0}},
+		{`unique_by(orders, &customer)[*].id`, []interface{}{1.0, 2.0, 4.0}},
+		{`distinct(orders[*].region)`, []interface{}{"eu", "us"}},
+		{"distinct(`[1, \"1\", 1, {\"a\": [1]}, {\"a\": [1]}, null, null]`)", []interface{}{1.0, "1", map[string]interface{}{"a": []interface{}{1.0}}, nil}},
+	})
+	runFunctionErrorTests(t, []string{
+		"group_by(`[{\"k\": 1}]`, &k)",
+		"count_by(`[{\"k\": true}]`, &k)",
+		"sum_by(`[{\"n\": \"1\"}]`, &n)",
+		"avg_by(`[{}]`, &n)",
+		"group_by(`{}`, &k)",
+		"distinct(`\"abc\"`)",
+	})
+}
+
+func TestGroupByPreserveOrder(t *testing.T) {
+	assert := assert.New(t)
+	var data interface{}
+	assert.Nil(json.Unmarshal(ordersFixture, &data))
+	jp, err := Compile("group_by(orders, &customer.name).*[*].id")
+	assert.Nil(err)
+	jp.SetOptions(Options{PreserveOrder: true})
+	result, err := jp.Search(data)
+	assert.Nil(err)
+	assert.Equal([]interface{}{
+		[]interface{}{1.0, 3.0},
+		[]interface{}{2.0},
+		[]interface{}{4.0},
+	}, result)
+}
+
+func TestMathFunctions(t *testing.T) {
+	runFunctionTests(t, []byte(`{"latencies": [120, 80, 95, 300, 101], "empty": []}`), []functionTestCase{
+		{"round(`2.5`)", 3.0},
+		{"round(`-2.5`)", -3.0},
+		{"round(`3.14159`, `2`)", 3.14},
+		{"round(`1234.5`, `-2`)", 1200.0},
+		{"round(`1.5`, `400`)", 1.5},
+		{"pow(`2`, `10`)", 1024.0},
+		{"pow(`0`, `-1`)", nil},
+		{"pow(`-8`, `0.5`)", nil},
+		{"sqrt(`16`)", 4.0},
+		{"sqrt(`-1`)", nil},
+		{"log(`1`)", 0.0},
+		{"log(`0`)", nil},
+		{"log(`1000`, `10`)", 2.9999999999999996},
+		{"log(`8`, `2`)", 3.0},
+		{"exp(`0`)", 1.0},
+		{"exp(`1000`)", nil},
+		{"mod(`7`, `3`)", 1.0},
+		{"mod(`-7`, `3`)", -1.0},
+		{"mod(`7`, `0`)", nil},
+		{"clamp(`15`, `0`, `10`)", 10.0},
+		{"clamp(`-5`, `0`, `10`)", 0.0},
+		{"clamp(`5`, `0`, `10`)", 5.0},
+		{`median(latencies)`, 101.0},
+		{"median(`[1, 2, 3, 4]`)", 2.5},
+		{`median(empty)`, nil},
+		{`percentile(latencies, ` + "`0`" + `)`, 80.0},
+		{`percentile(latencies, ` + "`100`" + `)`, 300.0},
+		{`percentile(latencies, ` + "`90`" + `)`, 228.0},
+		{`percentile(empty, ` + "`50`" + `)`, nil},
+		{"stddev(`[2, 4, 4, 4, 5, 5, 7, 9]`)", 2.0},
+		{`stddev(empty)`, nil},
+		{"product(`[2, 3, 4]`)", 24.0},
+		{`product(empty)`, 1.0},
+		{"product(`[1e200, 1e200]`)", nil},
+		{`latencies`, []interface{}{120.0, 80.0, 95.0, 300.0, 101.0}},
+	})
+	runFunctionErrorTests(t, []string{
+		"round(`1.5`, `0.5`)",
+		"clamp(`1`, `10`, `0`)",
+		"percentile(`[1]`, `101`)",
+		"percentile(`[1]`, `-1`)",
+		"median(`[\"a\"]`)",
+		"sqrt('4')",
+	})
+}
+
+func TestTypeFunctions(t *testing.T) {
+	runFunctionTests(t, []byte(`{"n": 1.5, "s": "x", "a": [], "o": {}, "b": false, "z": null, "doc": "{\"a\": [1, {\"b\": null}]}"}`), []functionTestCase{
+		{`[is_string(s), is_string(n), is_string(z)]`, []interface{}{true, false, false}},
+		{`[is_number(n), is_number(s)]`, []interface{}{true, false}},
+		{`[is_array(a), is_array(o)]`, []interface{}{true, false}},
+		{`[is_object(o), is_object(a)]`, []interface{}{true, false}},
+		{`[is_boolean(b), is_boolean(z)]`, []interface{}{true, false}},
+		{`[is_null(z), is_null(missing), is_null(b)]`, []interface{}{true, true, false}},
+		{"to_boolean(`true`)", true},
+		{"to_boolean('FALSE')", false},
+		{"to_boolean('True')", true},
+		{"to_boolean('yes')", nil},
+		{"to_boolean(`0`)", false},
+		{"to_boolean(`-2`)", true},
+		{"to_boolean(`[1]`)", nil},
+		{"to_boolean(`null`)", nil},
+		{"to_integer(`2.9`)", 2.0},
+		{"to_integer(`-2.9`)", -2.0},
+		{"to_integer('42.7')", 42.0},
+		{"to_integer('abc')", nil},
+		{"to_integer(`true`)", nil},
+		{`parse_json(doc).a[1]`, map[string]interface{}{"b": nil}},
+		{`parse_json('"str"')`, "str"},
+		{"to_json(`{\"a\": [1, \"<b>\"]}`)", `{"a":[1,"<b>"]}`},
+		{"to_json(`[1, 2]`, `2`)", "[\n  1,\n  2\n]"},
+		{"to_json(`{\"a\": 1}`, '\t')", "{\n\t\"a\": 1\n}"},
+		{`parse_json(to_json(@)).n`, 1.5},
+	})
+	runFunctionErrorTests(t, []string{
+		`parse_json('{')`,
+		`parse_json(@)`,
+		"to_json(`1`, `-1`)",
+		"to_json(`1`, `1.5`)",
+		"to_json(`1`, `100000000000`)",
+		"is_string()",
+	})
+}
+
+type typedValues struct {
+	Name  string
+	Ports []int
+	Tags  map[string]string
+	Count uint8
+	Ratio float32
+	Ptr   *int
+	On    bool
+	Ch    chan int
+}
+
+func TestTypeOfGoValues(t *testing.T) {
+	assert := assert.New(t)
+	data := &typedValues{Name: "x", Ports: []int{80}, Tags: map[string]string{}}
+	cases := map[string]interface{}{
+		"type(@)":          "object",
+		"type(Name)":       "string",
+		"type(Ports)":      "array",
+		"type(Tags)":       "object",
+		"type(Count)":      "number",
+		"type(Ratio)":      "number",
+		"type(Ptr)":        "null",
+		"type(On)":         "boolean",
+		"is_object(@)":     true,
+		"is_array(Ports)":  true,
+		"is_number(Count)": true,
+		"is_null(Ptr)":     true,
+		"is_object(Tags)":  true,
+	}
+	for expression, expected := range cases {
+		result, err := Search(expression, data)
+		if assert.Nil(err, expression) {
+			assert.Equal(expected, result, expression)
+		}
+	}
+	_, err := Search("type(Ch)", data)
+	assert.NotNil(err)
+	result, err := Search("is_number(Ch)", data)
+	assert.Nil(err)
+	assert.Equal(false, result)
+}
+
+func TestArrayFunctions(t *testing.T) {
+	runFunctionTests(t, []byte(`{"a": [1, 2, 3, 4, 5], "b": [4, 5, 6, 4], "nested": [1, [2, [3, [4]]], []], "empty": []}`), []functionTestCase{
+		{"slice(a, `1`, `3`)", []interface{}{2.0, 3.0}},
+		{"slice(a, `-2`)", []interface{}{4.0, 5.0}},
+		{"slice(a, `0`, `10`, `2`)", []interface{}{1.0, 3.0, 5.0}},
+		{"slice(a, `4`, `0`, `-2`)", []interface{}{5.0, 3.0}},
+		{"slice(a, `0`, `9223372036854775807`)", []interface{}{1.0, 2.0, 3.0, 4.0, 5.0}},
+		{"slice(a, `1`, `1e19`, `1e19`)", []interface{}{2.0}},
+		{"slice(a, `-1e19`, `1e19`, `-1e19`)", []interface{}{}},
+		{"slice(a, `3`, `-1e19`, `-1e19`)", []interface{}{4.0}},
+		{"chunk(a, `1e19`)", []interface{}{[]interface{}{1.0, 2.0, 3.0, 4.0, 5.0}}},
+		{"range(`5`, `1e19`, `1e19`)", []interface{}{5.0}},
+		{`flatten_deep(nested)`, []interface{}{1.0, 2.0, 3.0, 4.0}},
+		{"chunk(a, `2`)", []interface{}{
+			[]interface{}{1.0, 2.0},
+			[]interface{}{3.0, 4.0},
+			[]interface{}{5.0},
+		}},
+		{"chunk(empty, `3`)", []interface{}{}},
+		{`first(a)`, 1.0},
+		{`last(a)`, 5.0},
+		{`first(empty)`, nil},
+		{`last(empty)`, nil},
+		{"index_of(b, `4`)", 0.0},
+		{"index_of(b, `6`)", 2.0},
+		{"index_of(nested, `[]`)", 2.0},
+		{"index_of(b, '4')", nil},
+		{`concat(a, b)`, []interface{}{1.0, 2.0, 3.0, 4.0, 5.0, 4.0, 5.0, 6.0, 4.0}},
+		{`concat(empty)`, []interface{}{}},
+		{`unique(b)`, []interface{}{4.0, 5.0, 6.0}},
+		{`difference(a, b)`, []interface{}{1.0, 2.0, 3.0}},
+		{`difference(b, a)`, []interface{}{6.0}},
+		{`intersection(b, a)`, []interface{}{4.0, 5.0}},
+		{`union(a, b)`, []interface{}{1.0, 2.0, 3.0, 4.0, 5.0, 6.0}},
+		{"range(`0`, `3`)", []interface{}{0.0, 1.0, 2.0}},
+		{"range(`5`, `0`, `-2`)", []interface{}{5.0, 3.0, 1.0}},
+		{"range(`3`, `0`)", []interface{}{}},
+		{`a`, []interface{}{1.0, 2.0, 3.0, 4.0, 5.0}},
+	})
+	runFunctionErrorTests(t, []string{
+		"slice(`[1]`, `0.5`)",
+		"slice(`[1]`, `0`, `1`, `0`)",
+		"slice('abc', `1`)",
+		"chunk(`[1]`, `0`)",
+		"concat(`[1]`, `1`)",
+		"range(`0`, `3`, `0`)",
+		"range(`0`, `1.5`)",
+		"range(`0`, `1e10`)",
+		"range(`1e300`, `-1e300`, `-1`)",
+	})
+}
+
+var objectsFixture = []byte(`{
+	"defaults": {"replicas": 1, "image": {"name": "web", "tag": "1.0"}, "ports": [80]},
+	"override": {"image": {"tag": "2.0"}, "ports": [443], "debug": true},
+	"user": {"id": 7, "first_name": "Ann", "password": "secret", "address": {"city": "Oslo"}}
+}`)
+
+func TestObjectFunctions(t *testing.T) {
+	runFunctionTests(t, objectsFixture, []functionTestCase{
+		{`deep_merge(defaults, override)`, map[string]interface{}{
+			"replicas": 1.0,
+			"image":    map[string]interface{}{"name": "web", "tag": "2.0"},
+			"ports":    []interface{}{443.0},
+			"debug":    true,
+		}},
+		{"deep_merge(defaults, `{\"image\": \"web:3\"}`).image", "web:3"},
+		{`deep_merge(defaults)`, map[string]interface{}{
+			"replicas": 1.0,
+			"image":    map[string]interface{}{"name": "web", "tag": "1.0"},
+			"ports":    []interface{}{80.0},
+		}},
+		{"pick(user, ['id', 'first_name', 'missing'])", map[string]interface{}{"id": 7.0, "first_name": "Ann"}},
+		{"omit(user, ['password', 'address'])", map[string]interface{}{"id": 7.0, "first_name": "Ann"}},
+		{"rename_keys(pick(user, ['id', 'first_name']), `{\"first_name\": \"firstName\"}`)", map[string]interface{}{"id": 7.0, "firstName": "Ann"}},
+		{"get(user, 'address.city')", "Oslo"},
+		{"get(user, 'address.zip', 'none')", "none"},
+		{"get(user, 'address.zip')", nil},
+		{"get(`[{\"a\": 1}]`, '[0].a')", 1.0},
+		{"rename_keys(`{\"a\": 1, \"b\": 2}`, `{\"a\": \"b\", \"b\": \"a\"}`)", map[string]interface{}{"a": 2.0, "b": 1.0}},
+		{"set(user, 'id', `8`).id", 8.0},
+		{"set(`{}`, 'a', `[1]`)", map[string]interface{}{"a": []interface{}{1.0}}},
+		// None of the functions above modified their input.
+		{`defaults.image.tag`, "1.0"},
+		{`user.id`, 7.0},
+		{`keys(user) | sort(@)`, []interface{}{"address", "first_name", "id", "password"}},
+	})
+	runFunctionErrorTests(t, []string{
+		"deep_merge(`{}`, `[]`)",
+		"pick(`{}`, `[1]`)",
+		"rename_keys(`{\"a\": 1}`, `{\"a\": 1}`)",
+		"rename_keys(`{\"a\": 1, \"b\": 2}`, `{\"a\": \"b\"}`)",
+		"rename_keys(`{\"a\": 1, \"b\": 2}`, `{\"a\": \"c\", \"b\": \"c\"}`)",
+		"get(`{}`, 'a.[')",
+		"set(`{}`, `1`, `1`)",
+	})
+}
+
+func TestObjectFunctionsPreserveOrder(t *testing.T) {
+	assert := assert.New(t)
+	data, err := UnmarshalOrdered(objectsFixture)
+	assert.Nil(err)
+	jp, err := Compile("[deep_merge(defaults, override), rename_keys(omit(user, ['password']), `{\"id\": \"user_id\"}`)]")
+	assert.Nil(err)
+	jp.SetOptions(Options{PreserveOrder: true})
+	result, err := jp.Search(data)
+	assert.Nil(err)
+	encoded, err := json.Marshal(result)
+	assert.Nil(err)
+	assert.Equal(`[{"replicas":1,"image":{"name":"web","tag":"2.0"},"ports":[443],"debug":true},`+
+		`{"user_id":7,"first_name":"Ann","address":{"city":"Oslo"}}]`, string(encoded))
+}
+
+func TestHigherOrderFunctions(t *testing.T) {
+	runFunctionTests(t, ordersFixture, []functionTestCase{
+		{"filter(&total > `5`, orders)[*].id", []interface{}{1.0, 2.0}},
+		{"filter(&region, orders)[*].id", []interface{}{1.0, 2.0, 3.0}},
+		{"reduce(&sum([accumulated, current.total]), orders, `0`)", 41.0},
+		{"reduce(&merge(accumulated, from_items([[to_string(current.id), index]])), orders, `{}`)",
+			map[string]interface{}{"1": 0.0, "2": 1.0, "3": 2.0, "4": 3.0}},
+		{"reduce(&current, `[]`, 'init')", "init"},
+		{"any(&total > `20`, orders)", true},
+		{"any(&total > `100`, orders)", false},
+		{"any(&total, `[]`)", false},
+		{"all(&total > `0`, orders)", true},
+		{"all(&region, orders)", false},
+		{"all(&total, `[]`)", true},
+		{"find(&customer.name == 'ann', orders).id", 1.0},
+		{"find(&total > `100`, orders)", nil},
+		{"find_index(&region == 'us', orders)", 1.0},
+		{"find_index(&region == 'ca', orders)", nil},
+		{"flat_map(&[id, total], orders[:2])", []interface{}{1.0, 10.0, 2.0, 25.0}},
+		{"flat_map(&region, orders)", []interface{}{"eu", "us", "eu", nil}},
+	})
+	runFunctionErrorTests(t, []string{
+		"filter(`[1]`, &@)",
+		"reduce(&accumulated, `[1]`)",
+		"any(&length(@), `[1]`)",
+		"find_index(&@, `{}`)",
+	})
+}
+
+func TestEncodingFunctions(t *testing.T) {
+	runFunctionTests(t, []byte(`{"id": "order 42/é", "ns": "6ba7b811-9dad-11d1-80b4-00c04fd430c8"}`), []functionTestCase{
+		{`base64_encode(id)`, "b3JkZXIgNDIvw6k="},
+		{`base64_decode('b3JkZXIgNDIvw6k=')`, "order 42/é"},
+		{`base64_decode('b3JkZXIgNDIvw6k')`, "order 42/é"},
+		{`base64_decode(base64_encode(id)) == id`, true},
+		{`url_encode(id)`, "order+42%2F%C3%A9"},
+		{`url_decode('order+42%2F%C3%A9')`, "order 42/é"},
+		{`hex_encode('hi')`, "6869"},
+		{`sha256('')`, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{`md5('hello')`, "5d41402abc4b2a76b9719d911017c592"},
+		{`uuid_v5('dns', 'python.org')`, "886313e1-3b8a-5372-9b90-0c9aee199e5d"},
+		{`uuid_v5(ns, 'http://example.com/')`, "0a300ee9-f9e4-5697-a51a-efc7fafaba67"},
+		{`uuid_v5('URL', 'http://example.com/') == uuid_v5(ns, 'http://example.com/')`, true},
+		{`html_escape('<a href="x">Tom & Jerry</a>')`, "&lt;a href=&#34;x&#34;&gt;Tom &amp; Jerry&lt;/a&gt;"},
+	})
+	runFunctionErrorTests(t, []string{
+		`base64_decode('!!')`,
+		`base64_decode('/w==')`,
+		`url_decode('%zz')`,
+		`uuid_v5('not-a-uuid', 'x')`,
+		`uuid_v5('6ba7b8119dad11d180b400c04fd430c8', 'x')`,
+		"sha256(`1`)",
+	})
+}
+
+func TestNetworkFunctions(t *testing.T) {
+	runFunctionTests(t, []byte(`{"instances": [
+		{"id": "a", "ip": "10.0.1.5"},
+		{"id": "b", "ip": "10.0.2.7"},
+		{"id": "c", "ip": "2001:db8::1"}
+	]}`), []functionTestCase{
+		{"instances[?ip_in_cidr(ip, '10.0.1.0/24')].id", []interface{}{"a"}},
+		{"instances[?ip_in_cidr(ip, '10.0.0.0/16')].id", []interface{}{"a", "b"}},
+		{"instances[?ip_in_cidr(ip, '2001:db8::/32')].id", []interface{}{"c"}},
+		{"ip_in_cidr('::ffff:10.0.1.5', '10.0.1.0/24')", true},
+		{"instances[*].ip_version(ip)", []interface{}{4.0, 4.0, 6.0}},
+		{"ip_version('example.com')", nil},
+		{"cidr_contains('10.0.0.0/8', '10.1.0.0/16')", true},
+		{"cidr_contains('10.1.0.0/16', '10.0.0.0/8')", false},
+		{"cidr_contains('10.0.0.0/8', '10.255.255.255')", true},
+		{"cidr_contains('10.0.0.0/8', '11.0.0.1')", false},
+		{"cidr_contains('::/0', '10.0.0.1')", false},
+		{"is_private_ip('172.20.1.1')", true},
+		{"is_private_ip('172.32.0.1')", false},
+		{"is_private_ip('192.168.0.1')", true},
+		{"is_private_ip('8.8.8.8')", false},
+		{"is_private_ip('fd12::1')", true},
+		{"parse_url('https://api.example.com:8443/v1/items?page=2&tag=a&tag=b#top')", map[string]interface{}{
+			"scheme":   "https",
+			"host":     "api.example.com",
+			"port":     8443.0,
+			"path":     "/v1/items",
+			"query":    map[string]interface{}{"page": "2", "tag": "a"},
+			"fragment": "top",
+		}},
+		{"parse_url('http://[::1]/').[host, port, query]", []interface{}{"::1", nil, map[string]interface{}{}}},
+	})
+	runFunctionErrorTests(t, []string{
+		"ip_in_cidr('10.0.0.300', '10.0.0.0/8')",
+		"ip_in_cidr('10.0.0.1', '10.0.0.0/33')",
+		"cidr_contains('10.0.0.0', 'x')",
+		"is_private_ip('')",
+		"parse_url('http://a b.com:x/')",
+	})
+}
+
+func TestSemverFunctions(t *testing.T) {
+	runFunctionTests(t, []byte(`{"releases": [
+		{"name": "b", "version": "1.10.0"},
+		{"name": "a", "version": "1.9.0"},
+		{"name": "c", "version": "1.10.0-rc.1"},
+		{"name": "d", "version": "2.0.0"}
+	]}`), []functionTestCase{
+		{"semver_compare('1.10.0', '1.9.0')", 1.0},
+		{"semver_compare('1.0.0-rc.1', '1.0.0')", -1.0},
+		{"semver_compare('1.0.0+a', '1.0.0+b')", 0.0},
+		{"releases[?semver_satisfies(version, '^1.9')].name", []interface{}{"b", "a", "c"}},
+		{"releases[?semver_satisfies(version, '>=1.10 <3')].name", []interface{}{"b", "d"}},
+		{"sort_by(releases, &semver_key(version))[*].version", []interface{}{"1.9.0", "1.10.0-rc.1", "1.10.0", "2.0.0"}},
+		{"max_by(releases, &semver_key(version)).name", "d"},
+		{"min_by(releases[?name != 'a'], &semver_key(version)).name", "c"},
+		{"semver_parse('v1.2.3-beta.4+exp.sha.5114f85')", map[string]interface{}{
+			"major":      1.0,
+			"minor":      2.0,
+			"patch":      3.0,
+			"prerelease": []interface{}{"beta", "4"},
+			"build":      "exp.sha.5114f85",
+		}},
+		{"semver_parse('1.2.3').[prerelease, build]", []interface{}{[]interface{}{}, nil}},
+		{"semver_parse('1.2')", nil},
+	})
+	runFunctionErrorTests(t, []string{
+		"semver_compare('1.2', '1.2.0')",
+		"semver_satisfies('1.2.0', '>>1')",
+		"semver_key('latest')",
+	})
+}
+
+func TestSortByMultipleKeys(t *testing.T) {
+	runFunctionTests(t, []byte(`{"people": [
+		{"name": "d", "team": "b", "age": 30},
+		{"name": "a", "team": "a", "age": 40},
+		{"name": "c", "team": "b", "age": 20},
+		{"name": "b", "team": "a", "age": 40, "nick": "bee"},
+		{"name": "e", "team": "a", "age": 25, "nick": "ee"}
+	]}`), []functionTestCase{
+		{`sort_by(people, &team, &age)[*].name`, []interface{}{"e", "a", "b", "c", "d"}},
+		{`sort_by(people, &age, &name)[*].name`, []interface{}{"c", "e", "d", "a", "b"}},
+		{`reverse_sort_by(people, &age)[*].name`, []interface{}{"a", "b", "d", "e", "c"}},
+		{`reverse_sort_by(people, &team, &age)[*].name`, []interface{}{"d", "c", "a", "b", "e"}},
+		{`sort_by(people, &team, &nick)[*].name`, []interface{}{"b", "e", "a", "d", "c"}},
+		{`reverse_sort_by(people, &team, &nick)[*].name`, []interface{}{"d", "c", "e", "b", "a"}},
+		{"sort_by(`[]`, &a, &b)", []interface{}{}},
+		{"sort_by(`[{\"id\": 1, \"b\": \"x\"}, {\"id\": 2}, {\"id\": 3, \"b\": 1}]`, &`0`, &b)[*].id", []interface{}{3.0, 1.0, 2.0}},
+		{"reverse_sort_by(`[{\"id\": 1, \"b\": \"x\"}, {\"id\": 2}, {\"id\": 3, \"b\": 1}]`, &`0`, &b)[*].id", []interface{}{1.0, 3.0, 2.0}},
+		// The input array is not sorted in place.
+		{`[sort_by(people, &name)[0].name, people[0].name]`, []interface{}{"a", "d"}},
+	})
+	runFunctionErrorTests(t, []string{
+		"sort_by(`[{\"a\": 1}, {\"a\": \"1\"}]`, &a)",
+		"sort_by(`[{\"a\": 1}, {}]`, &a)",
+		"sort_by(`[{\"a\": 1, \"b\": true}]`, &a, &b)",
+		"reverse_sort_by(`[{\"a\": [1]}]`, &a)",
+		"sort_by(`[1]`, &@, 'a')",
+		"reverse_sort_by(`[1]`)",
+	})
+}
+
+type sortTeam string
+
+type sortRecord struct {
+	ID    int
+	Score float32
+	Team  sortTeam
+}
+
+func TestSortByStructKeys(t *testing.T) {
+	data := []sortRecord{{3, 0.5, "b"}, {1, 2.5, "a"}, {2, 1.5, "b"}}
+	runFunctionTestsOn(t, data, []functionTestCase{
+		{`sort_by(@, &ID)[*].ID`, []interface{}{1, 2, 3}},
+		{`reverse_sort_by(@, &ID)[*].ID`, []interface{}{3, 2, 1}},
+		{`sort_by(@, &Score)[*].ID`, []interface{}{3, 2, 1}},
+		{`sort_by(@, &Team, &ID)[*].ID`, []interface{}{1, 2, 3}},
+	})
+}
+
+func TestSortByEvaluatesKeysOnce(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	jp, err := Compile("sort_by(@, &count_calls(@))")
+	assert.Nil(err)
+	err = jp.intr.fCall.AddCustomFunction(FunctionEntry{
+		name:      "count_calls",
+		arguments: []ArgSpec{{types: []JPType{JPNumber}}},
+		handler: func(arguments []interface{}) (interface{}, error) {
+			calls++
+			return arguments[0], nil
+		},
+	})
+	assert.Nil(err)
+	data := []interface{}{5.0, 3.0, 9.0, 1.0, 7.0, 2.0, 8.0, 4.0, 6.0, 0.0}
+	result, err := jp.Search(data)
+	assert.Nil(err)
+	assert.Equal([]interface{}{0.0, 1.0, 2.0, 3.0, 4.0, 5.0, 6.0, 7.0, 8.0, 9.0}, result)
+	assert.Equal(len(data), calls)
+}
+
+func TestCollationFunctions(t *testing.T) {
+	runFunctionTests(t, []byte(`{"names": ["b", "A", "a", "C"]}`), []functionTestCase{
+		{`sort_ci(names)`, []interface{}{"A", "a", "b", "C"}},
+		{`sort(names)`, []interface{}{"A", "C", "a", "b"}},
+		{`equals_ci('Straße', 'STRASSE')`, true},
+		{`equals_ci('abc', 'abd')`, false},
+		{"normalize('é')", "é"},
+		{"normalize('é', 'nfd')", "é"},
+		{`normalize('ﬁ①', 'NFKC')`, "fi1"},
+		{`normalize('ﬁ①', 'NFKD')`, "fi1"},
+	})
+	runFunctionErrorTests(t, []string{
+		"normalize('a', 'NFX')",
+		"sort_ci(`[1, 2]`)",
+		"equals_ci('a', `null`)",
+	})
+}
@@ -2,4 +2,7 @@ module github.com/jmespath/go-jmespath
 
 go 1.14
 
-require github.com/jmespath/go-jmespath/internal/testify v1.5.1
+require (
+	github.com/jmespath/go-jmespath/internal/testify v1.5.1
+	golang.org/x/text v0.3.8
+)
@@ -2,7 +2,10 @@ package jmespath
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
+	"regexp"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 )
@@ -13,6 +16,15 @@ import (
 
 type treeInterpreter struct {
 	fCall *functionCaller
+	opts  Options
+
+	// Regular expressions passed as literals to the regex functions in
+	// the compiled expression, compiled once by SetExpression.  The map
+	// isn't modified afterwards.
+	regexps map[string]*regexp.Regexp
+	// Paths passed as literals to get() in the compiled expression,
+	// parsed once by SetExpression.  The map isn't modified afterwards.
+	paths map[string]ASTNode
 }
 
 func newInterpreter() *treeInterpreter {
@@ -21,14 +33,184 @@ func newInterpreter() *treeInterpreter {
 	return &interpreter
 }
 
+// regexpFunctions are the functions whose second argument is a regular
+// expression.
+var regexpFunctions = map[string]bool{
+	"match":            true,
+	"find_all":         true,
+	"regex_match":      true,
+	"regex_find_first": true,
+	"regex_find_all":   true,
+	"regex_replace":    true,
+	"regex_split":      true,
+}
+
+// precompileRegexps compiles the patterns passed as string literals to the
+// regex functions in node.  Invalid patterns are left out, so that the
+// error is reported when the function is called.
+func precompileRegexps(node ASTNode, compiled map[string]*regexp.Regexp) map[string]*regexp.Regexp {
+	if node.nodeType == ASTFunctionExpression && regexpFunctions[node.value.(string)] && len(node.children) > 1 {
+		if pattern, ok := node.children[1].value.(string); ok && node.children[1].nodeType == ASTLiteral {
+			if re, err := regexp.Compile(pattern); err == nil {
+				if compiled == nil {
+					compiled = make(map[string]*regexp.Regexp)
+				}
+				compiled[pattern] = re
+			}
+		}
+	}
+	for _, child := range node.children {
+		compiled = precompileRegexps(child, compiled)
+	}
+	return compiled
+}
+
+// compileRegexp returns the compiled form of pattern, which was compiled
+// in advance if it is a literal in the compiled expression.  Patterns
+// taken from the data are compiled on every call rather than cached, so
+// that they can't make a long-lived JMESPath grow without bounds.
+func (intr *treeInterpreter) compileRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := intr.regexps[pattern]; ok {
+		return re, nil
+	}
+	return regexp.Compile(pattern)
+}
+
+// precompilePaths parses the paths passed as string literals to get() in
+// node.  Invalid paths are left out, so that the error is reported when
+// the function is called.
+func precompilePaths(node ASTNode, parsed map[string]ASTNode) map[string]ASTNode {
+	if node.nodeType == ASTFunctionExpression && node.value == "get" && len(node.children) > 1 {
+		if path, ok := node.children[1].value.(string); ok && node.children[1].nodeType == ASTLiteral {
+			if ast, err := NewParser().Parse(path); err == nil {
+				if parsed == nil {
+					parsed = make(map[string]ASTNode)
+				}
+				parsed[path] = ast
+			}
+		}
+	}
+	for _, child := range node.children {
+		parsed = precompilePaths(child, parsed)
+	}
+	return parsed
+}
+
+// parsePath returns the parsed form of path, which was parsed in advance
+// if it is a literal in the compiled expression.  Like patterns, paths
+// taken from the data are parsed on every call.
+func (intr *treeInterpreter) parsePath(path string) (ASTNode, error) {
+	if ast, ok := intr.paths[path]; ok {
+		return ast, nil
+	}
+	return NewParser().Parse(path)
+}
+
 type expRef struct {
 	ref ASTNode
 }
 
+// EvaluationError is returned in strict mode when part of an expression is
+// applied to a value of the wrong type, for example a field to an array or
+// the < comparator to a string, where JMESPath otherwise returns null.
+type EvaluationError struct {
+	msg        string // Error message displayed to user
+	Expression string // Expression that generated an EvaluationError
+	Offset     int    // The location in the string where the error occurred
+}
+
+func (e EvaluationError) Error() string {
+	return "EvaluationError: " + e.msg
+}
+
+// HighlightLocation will show where the evaluation error occurred.
+// It will place a "^" character on a line below the expression
+// at the start of the part of the expression that failed.
+func (e EvaluationError) HighlightLocation() string {
+	return e.Expression + "\n" + strings.Repeat(" ", e.Offset) + "^"
+}
+
+// withExpression fills in the expression of an EvaluationError, which the
+// interpreter only knows the location in.
+func withExpression(err error, expression string) error {
+	if evalErr, ok := err.(EvaluationError); ok {
+		evalErr.Expression = expression
+		return evalErr
+	}
+	return err
+}
+
+var comparatorSymbols = map[tokType]string{
+	tEQ:  "==",
+	tNE:  "!=",
+	tGT:  ">",
+	tGTE: ">=",
+	tLT:  "<",
+	tLTE: "<=",
+}
+
+// strictError returns the error reported in strict mode when node is
+// applied to value, which has the wrong type, or nil when it isn't in
+// strict mode.  Null values propagate as null even in strict mode, so that
+// a missing key such as "foo" in "foo.bar" isn't an error.
+func (intr *treeInterpreter) strictError(node ASTNode, value interface{}, expected string) error {
+	if !intr.opts.Strict || value == nil {
+		return nil
+	}
+	if name, _ := jpTypeOf(value); name == "null" {
+		return nil
+	}
+	return EvaluationError{
+		msg:    fmt.Sprintf("%s expects %s, received %s", describeNode(node), expected, typeName(value)),
+		Offset: node.offset,
+	}
+}
+
+// describeNode names the part of an expression node stands for in error
+// messages.
+func describeNode(node ASTNode) string {
+	switch node.nodeType {
+	case ASTField:
+		return fmt.Sprintf("field %q", node.value)
+	case ASTFilterProjection:
+		return "filter projection"
+	case ASTFlatten:
+		return "flatten"
+	case ASTIndex:
+		return fmt.Sprintf("index [%d]", node.value)
+	case ASTProjection:
+		return "projection"
+	case ASTSlice:
+		return "slice"
+	case ASTValueProjection:
+		return "object projection"
+	}
+	return node.nodeType.String()
+}
+
+// typeName returns the JMESPath type name of value, or its Go type if it
+// has none.
+func typeName(value interface{}) string {
+	if name, ok := jpTypeOf(value); ok {
+		return name
+	}
+	return fmt.Sprintf("%T", value)
+}
+
 // Execute takes an ASTNode and input data and interprets the AST directly.
 // It will produce the result of applying the JMESPath expression associated
 // with the ASTNode to the input data "value".
 func (intr *treeInterpreter) Execute(node ASTNode, value interface{}) (interface{}, error) {
+	if intr.opts.Tracer == nil {
+		return intr.execute(node, value)
+	}
+	intr.opts.Tracer.Enter(node, value)
+	result, err := intr.execute(node, value)
+	intr.opts.Tracer.Exit(node, result, err)
+	return result, err
+}
+
+func (intr *treeInterpreter) execute(node ASTNode, value interface{}) (interface{}, error) {
 	switch node.nodeType {
 	case ASTComparator:
 		left, err := intr.Execute(node.children[0], value)
@@ -45,12 +227,25 @@ func (intr *treeInterpreter) Execute(node ASTNode, value interface{}) (interface
 		case tNE:
 			return !objsEqual(left, right), nil
 		}
-		leftNum, ok := left.(float64)
-		if !ok {
-			return nil, nil
+		if leftStr, ok := left.(string); ok && intr.opts.StringComparisons {
+			if rightStr, ok := right.(string); ok {
+				return isOrdered(node.value.(tokType), intr.opts.Collation.compare(leftStr, rightStr)), nil
+			}
 		}
-		rightNum, ok := right.(float64)
-		if !ok {
+		// Numbers can also come from user defined structs, as an int
+		// field for instance.
+		leftNum, leftOk := toFloat(left)
+		rightNum, rightOk := toFloat(right)
+		if !leftOk || !rightOk {
+			// Like a field of null, comparing null, such as a missing
+			// key, gives null even in strict mode.
+			if intr.opts.Strict && left != nil && right != nil {
+				return nil, EvaluationError{
+					msg: fmt.Sprintf("%s expects numbers, received %s and %s",
+						comparatorSymbols[node.value.(tokType)], typeName(left), typeName(right)),
+					Offset: node.offset,
+				}
+			}
 			return nil, nil
 		}
 		switch node.value {
@@ -80,27 +275,35 @@ func (intr *treeInterpreter) Execute(node ASTNode, value interface{}) (interface
 			key := node.value.(string)
 			return m[key], nil
 		}
+		if m, ok := value.(*OrderedMap); ok {
+			result, _ := m.Get(node.value.(string))
+			return result, nil
+		}
+		if name, _ := jpTypeOf(value); name != "object" {
+			if err := intr.strictError(node, value, "an object"); err != nil {
+				return nil, err
+			}
+		}
 		return intr.fieldFromStruct(node.value.(string), value)
 	case ASTFilterProjection:
 		left, err := intr.Execute(node.children[0], value)
 		if err != nil {
-			return nil, nil
+			return nil, intr.leftError(err)
 		}
 		sliceType, ok := left.([]interface{})
 		if !ok {
 			if isSliceType(left) {
 				return intr.filterProjectionWithReflection(node, left)
 			}
-			return nil, nil
+			return nil, intr.strictError(node, left, "an array")
 		}
-		compareNode := node.children[2]
 		collected := []interface{}{}
 		for _, element := range sliceType {
-			result, err := intr.Execute(compareNode, element)
+			matched, err := intr.matchesFilter(node, element)
 			if err != nil {
 				return nil, err
 			}
-			if !isFalse(result) {
+			if matched {
 				current, err := intr.Execute(node.children[1], element)
 				if err != nil {
 					return nil, err
@@ -114,7 +317,7 @@ func (intr *treeInterpreter) Execute(node ASTNode, value interface{}) (interface
 	case ASTFlatten:
 		left, err := intr.Execute(node.children[0], value)
 		if err != nil {
-			return nil, nil
+			return nil, intr.leftError(err)
 		}
 		sliceType, ok := left.([]interface{})
 		if !ok {
@@ -124,7 +327,7 @@ func (intr *treeInterpreter) Execute(node ASTNode, value interface{}) (interface
 			if isSliceType(left) {
 				return intr.flattenWithReflection(left)
 			}
-			return nil, nil
+			return nil, intr.strictError(node, left, "an array")
 		}
 		flattened := []interface{}{}
 		for _, element := range sliceType {
@@ -146,11 +349,7 @@ func (intr *treeInterpreter) Execute(node ASTNode, value interface{}) (interface
 		return value, nil
 	case ASTIndex:
 		if sliceType, ok := value.([]interface{}); ok {
-			index := node.value.(int)
-			if index < 0 {
-				index += len(sliceType)
-			}
-			if index < len(sliceType) && index >= 0 {
+			if index, ok := indexPosition(node, len(sliceType)); ok {
 				return sliceType[index], nil
 			}
 			return nil, nil
@@ -158,24 +357,35 @@ func (intr *treeInterpreter) Execute(node ASTNode, value interface{}) (interface
 		// Otherwise try via reflection.
 		rv := reflect.ValueOf(value)
 		if rv.Kind() == reflect.Slice {
-			index := node.value.(int)
-			if index < 0 {
-				index += rv.Len()
-			}
-			if index < rv.Len() && index >= 0 {
+			if index, ok := indexPosition(node, rv.Len()); ok {
 				v := rv.Index(index)
 				return v.Interface(), nil
 			}
+			return nil, nil
 		}
-		return nil, nil
+		return nil, intr.strictError(node, value, "an array")
 	case ASTKeyValPair:
 		return intr.Execute(node.children[0], value)
 	case ASTLiteral:
+		if intr.opts.PreserveOrder && node.ordered != nil {
+			return node.ordered, nil
+		}
 		return node.value, nil
 	case ASTMultiSelectHash:
 		if value == nil {
 			return nil, nil
 		}
+		if intr.opts.PreserveOrder {
+			collected := NewOrderedMap()
+			for _, child := range node.children {
+				current, err := intr.Execute(child, value)
+				if err != nil {
+					return nil, err
+				}
+				collected.Set(child.value.(string), current)
+			}
+			return collected, nil
+		}
 		collected := make(map[string]interface{})
 		for _, child := range node.children {
 			current, err := intr.Execute(child, value)
@@ -249,7 +459,7 @@ func (intr *treeInterpreter) Execute(node ASTNode, value interface{}) (interface
 			if isSliceType(left) {
 				return intr.projectWithReflection(node, left)
 			}
-			return nil, nil
+			return nil, intr.strictError(node, left, "an array")
 		}
 		collected := []interface{}{}
 		var current interface{}
@@ -275,29 +485,21 @@ func (intr *treeInterpreter) Execute(node ASTNode, value interface{}) (interface
 			if isSliceType(value) {
 				return intr.sliceWithReflection(node, value)
 			}
-			return nil, nil
+			return nil, intr.strictError(node, value, "an array")
 		}
-		parts := node.value.([]*int)
-		sliceParams := make([]sliceParam, 3)
-		for i, part := range parts {
-			if part != nil {
-				sliceParams[i].Specified = true
-				sliceParams[i].N = *part
-			}
-		}
-		return slice(sliceType, sliceParams)
+		return slice(sliceType, sliceParams(node))
 	case ASTValueProjection:
 		left, err := intr.Execute(node.children[0], value)
 		if err != nil {
-			return nil, nil
+			return nil, intr.leftError(err)
 		}
-		mapType, ok := left.(map[string]interface{})
-		if !ok {
-			return nil, nil
+		if !isObject(left) {
+			return nil, intr.strictError(node, left, "an object")
 		}
-		values := make([]interface{}, len(mapType))
-		for _, value := range mapType {
-			values = append(values, value)
+		keys := objectKeys(left, intr.opts.SortKeys)
+		values := make([]interface{}, 0, len(keys))
+		for _, key := range keys {
+			values = append(values, objectGet(left, key))
 		}
 		collected := []interface{}{}
 		for _, element := range values {
@@ -314,6 +516,53 @@ func (intr *treeInterpreter) Execute(node ASTNode, value interface{}) (interface
 	return nil, errors.New("Unknown AST node: " + node.nodeType.String())
 }
 
+// The helpers below hold the parts of the semantics of fields, indexes,
+// slices, filters, flattens and projections that Execute shares with
+// locate, which evaluates them while tracking paths.
+
+// leftError returns the error reported when the left hand side of a
+// filter, flatten or object projection fails.  The node evaluates to
+// null instead unless Strict is set.
+func (intr *treeInterpreter) leftError(err error) error {
+	if intr.opts.Strict {
+		return err
+	}
+	return nil
+}
+
+// indexPosition returns the position an index node selects in an array of
+// the given length, counting negative indexes from the end, and whether
+// that position exists.
+func indexPosition(node ASTNode, length int) (int, bool) {
+	index := node.value.(int)
+	if index < 0 {
+		index += length
+	}
+	return index, index >= 0 && index < length
+}
+
+// sliceParams returns the start, stop and step of a slice node.
+func sliceParams(node ASTNode) []sliceParam {
+	params := make([]sliceParam, 3)
+	for i, part := range node.value.([]*int) {
+		if part != nil {
+			params[i].Specified = true
+			params[i].N = *part
+		}
+	}
+	return params
+}
+
+// matchesFilter reports whether element satisfies the condition of a
+// filter projection node.
+func (intr *treeInterpreter) matchesFilter(node ASTNode, element interface{}) (bool, error) {
+	result, err := intr.Execute(node.children[2], element)
+	if err != nil {
+		return false, err
+	}
+	return !isFalse(result), nil
+}
+
 func (intr *treeInterpreter) fieldFromStruct(key string, value interface{}) (interface{}, error) {
 	rv := reflect.ValueOf(value)
 	first, n := utf8.DecodeRuneInString(key)
@@ -362,33 +611,24 @@ func (intr *treeInterpreter) flattenWithReflection(value interface{}) (interface
 
 func (intr *treeInterpreter) sliceWithReflection(node ASTNode, value interface{}) (interface{}, error) {
 	v := reflect.ValueOf(value)
-	parts := node.value.([]*int)
-	sliceParams := make([]sliceParam, 3)
-	for i, part := range parts {
-		if part != nil {
-			sliceParams[i].Specified = true
-			sliceParams[i].N = *part
-		}
-	}
 	final := []interface{}{}
 	for i := 0; i < v.Len(); i++ {
 		element := v.Index(i).Interface()
 		final = append(final, element)
 	}
-	return slice(final, sliceParams)
+	return slice(final, sliceParams(node))
 }
 
 func (intr *treeInterpreter) filterProjectionWithReflection(node ASTNode, value interface{}) (interface{}, error) {
-	compareNode := node.children[2]
 	collected := []interface{}{}
 	v := reflect.ValueOf(value)
 	for i := 0; i < v.Len(); i++ {
 		element := v.Index(i).Interface()
-		result, err := intr.Execute(compareNode, element)
+		matched, err := intr.matchesFilter(node, element)
 		if err != nil {
 			return nil, err
 		}
-		if !isFalse(result) {
+		if matched {
 			current, err := intr.Execute(node.children[1], element)
 			if err != nil {
 				return nil, err
@@ -181,6 +181,126 @@ func TestCanSupportSliceOfStructsWithFunctions(t *testing.T) {
 	assert.Equal(result.(float64), 2.0)
 }
 
+func TestStringComparisons(t *testing.T) {
+	assert := assert.New(t)
+	data := map[string]interface{}{
+		"events": []interface{}{
+			map[string]interface{}{"id": 1.0, "ts": "2023-12-31T23:59:59Z"},
+			map[string]interface{}{"id": 2.0, "ts": "2024-01-01T00:00:00Z"},
+			map[string]interface{}{"id": 3.0, "ts": "2024-03-05T12:00:00Z"},
+		},
+	}
+	cases := []struct {
+		expression string
+		opts       Options
+		expected   interface{}
+	}{
+		{"events[?ts >= '2024-01-01'].id", Options{}, []interface{}{}},
+		{"'a' < 'b'", Options{}, nil},
+		{"events[?ts >= '2024-01-01'].id", Options{StringComparisons: true}, []interface{}{2.0, 3.0}},
+		{"events[?ts < '2024-01-01T00:00:00Z'].id", Options{StringComparisons: true}, []interface{}{1.0}},
+		{"events[?ts > '2024-01-01T00:00:00Z' && ts <= '2024-12-31'].id", Options{StringComparisons: true}, []interface{}{3.0}},
+		{"['a' < 'b', 'b' <= 'b', 'B' > 'a', 'b' >= 'c']", Options{StringComparisons: true}, []interface{}{true, true, false, false}},
+		{"'B' > 'a'", Options{StringComparisons: true, Collation: Collation{IgnoreCase: true}}, true},
+		{"'file10' > 'file9'", Options{StringComparisons: true, Collation: Collation{Natural: true}}, true},
+		// Only two strings or two numbers can be ordered.
+		{"'1' < `2`", Options{StringComparisons: true}, nil},
+		{"`null` < 'a'", Options{StringComparisons: true}, nil},
+		{"`1` < `2`", Options{StringComparisons: true}, true},
+	}
+	for _, tt := range cases {
+		jp, err := Compile(tt.expression)
+		assert.Nil(err)
+		jp.SetOptions(tt.opts)
+		result, err := jp.Search(data)
+		if assert.Nil(err, tt.expression) {
+			assert.Equal(tt.expected, result, tt.expression)
+		}
+	}
+}
+
+func TestStrictMode(t *testing.T) {
+	assert := assert.New(t)
+	data := map[string]interface{}{
+		"name":  "widget",
+		"tags":  []interface{}{"a", "b"},
+		"sizes": []interface{}{1.0, "2", 3.0},
+		"owner": map[string]interface{}{"name": "kim"},
+	}
+	errorCases := []struct {
+		expression string
+		message    string
+		offset     int
+	}{
+		{"name.first", `EvaluationError: field "first" expects an object, received string`, 5},
+		{"tags[0].id", `EvaluationError: field "id" expects an object, received string`, 8},
+		{"owner[0]", "EvaluationError: index [0] expects an array, received object", 5},
+		{"name[1:]", "EvaluationError: slice expects an array, received string", 4},
+		{"owner[*].name", "EvaluationError: projection expects an array, received object", 5},
+		{"name.*", "EvaluationError: object projection expects an object, received string", 4},
+		{"owner[]", "EvaluationError: flatten expects an array, received object", 5},
+		{"owner[?name]", "EvaluationError: filter projection expects an array, received object", 5},
+		{"sizes[?@ > `1`]", "EvaluationError: > expects numbers, received string and number", 9},
+		{"tags[?@ < `1`]", "EvaluationError: < expects numbers, received string and number", 8},
+		// Errors in the left hand side used to be swallowed.
+		{"name.first[]", `EvaluationError: field "first" expects an object, received string`, 5},
+		{"name.first[?x]", `EvaluationError: field "first" expects an object, received string`, 5},
+		{"name.first.*", `EvaluationError: field "first" expects an object, received string`, 5},
+	}
+	for _, tt := range errorCases {
+		jp, err := Compile(tt.expression)
+		assert.Nil(err)
+		jp.SetOptions(Options{Strict: true})
+		_, err = jp.Search(data)
+		if assert.IsType(EvaluationError{}, err, tt.expression) {
+			evalErr := err.(EvaluationError)
+			assert.Equal(tt.message, evalErr.Error(), tt.expression)
+			assert.Equal(tt.expression, evalErr.Expression)
+			assert.Equal(tt.offset, evalErr.Offset, tt.expression)
+		}
+		// Without Strict, the same expressions don't fail.
+		jp.SetOptions(Options{})
+		_, err = jp.Search(data)
+		assert.Nil(err, tt.expression)
+	}
+	// Null values and missing keys still propagate as null.
+	for _, expression := range []string{"missing.name", "missing[0]", "missing[*]", "missing[?x]", "missing[]", "missing.*", "owner.age", "tags[5]", "missing <= `1`", "owner.age > `1`"} {
+		jp := MustCompile(expression)
+		jp.SetOptions(Options{Strict: true})
+		result, err := jp.Search(data)
+		assert.Nil(err, expression)
+		assert.Nil(result, expression)
+	}
+	jp := MustCompile("owner.name == 'kim' && sizes[0] < `2`")
+	jp.SetOptions(Options{Strict: true})
+	result, err := jp.Search(data)
+	assert.Nil(err)
+	assert.Equal(true, result)
+	// The numbers of user defined structs are compared like any other.
+	type item struct {
+		ID    int
+		Price float32
+	}
+	items := []item{{1, 2.5}, {2, 0.5}, {3, 1.5}}
+	for _, strict := range []bool{true, false} {
+		jp = MustCompile("[?ID > `1` && Price >= `1`].ID")
+		jp.SetOptions(Options{Strict: strict})
+		result, err = jp.Search(items)
+		assert.Nil(err)
+		assert.Equal([]interface{}{3}, result)
+	}
+}
+
+func TestEvaluationErrorHighlightLocation(t *testing.T) {
+	assert := assert.New(t)
+	jp := NewJMESPath()
+	jp.SetOptions(Options{Strict: true})
+	_, err := jp.SearchWithExpression("foo.bar.baz", map[string]interface{}{"foo": map[string]interface{}{"bar": 1.0}})
+	if assert.IsType(EvaluationError{}, err) {
+		assert.Equal("foo.bar.baz\n        ^", err.(EvaluationError).HighlightLocation())
+	}
+}
+
 func BenchmarkInterpretSingleFieldStruct(b *testing.B) {
 	intr := newInterpreter()
 	parser := NewParser()
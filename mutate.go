@@ -0,0 +1,304 @@
+package jmespath
+
+import (
+	"fmt"
+)
+
+// Set returns a copy of data in which every location selected by the
+// compiled expression holds value.  The expression must only use the parts
+// of the grammar that select locations in the document: fields, indices,
+// slices, projections ("[*]", "*" and "[]") and filters, for instance
+// "spec.containers[?name=='app'].image".  Fields that don't exist yet are
+// created, including missing intermediate objects.  Selecting a location
+// that can't be created, such as a field of a string or an element past
+// the end of an array, is an error.
+//
+// The input is never modified.  Only the objects and arrays on the way to
+// a modified location are copied, everything else is shared between data
+// and the returned document.
+func (jp *JMESPath) Set(data interface{}, value interface{}) (interface{}, error) {
+	return jp.Update(data, func(interface{}) interface{} {
+		return value
+	})
+}
+
+// Update is like Set, but replaces every selected value with the result of
+// calling fn with its current value, or nil if it doesn't exist yet.  If fn
+// returns Remove the value is deleted instead.
+func (jp *JMESPath) Update(data interface{}, fn func(old interface{}) interface{}) (interface{}, error) {
+	locations, err := jp.locations(data, createLocations)
+	if err != nil {
+		return nil, err
+	}
+	edits := make([]edit, len(locations))
+	for i, location := range locations {
+		value := fn(location.Value)
+		edits[i] = edit{path: location.Path, value: value, remove: value == Remove}
+	}
+	updated, _, err := applyEdits(data, edits)
+	return updated, err
+}
+
+// Delete returns a copy of data without the object keys and array elements
+// selected by the compiled expression, along with the number of values
+// that were removed.  The expression is restricted in the same way as for
+// Set, and the input is not modified either.  For example
+// "items[?status=='stale']" removes matching elements from the items
+// array and "metadata.annotations.*" removes every annotation.
+func (jp *JMESPath) Delete(data interface{}) (interface{}, int, error) {
+	locations, err := jp.locations(data, findLocations)
+	if err != nil {
+		return nil, 0, err
+	}
+	edits := make([]edit, len(locations))
+	for i, location := range locations {
+		edits[i] = edit{path: location.Path, remove: true}
+	}
+	return applyEdits(data, edits)
+}
+
+// Set returns a copy of data in which every location selected by a
+// JMESPath expression holds value.
+func Set(data interface{}, expression string, value interface{}) (interface{}, error) {
+	jp, err := Compile(expression)
+	if err != nil {
+		return nil, err
+	}
+	return jp.Set(data, value)
+}
+
+// Update returns a copy of data in which every value selected by a
+// JMESPath expression is replaced by the result of calling fn with it.
+func Update(data interface{}, expression string, fn func(old interface{}) interface{}) (interface{}, error) {
+	jp, err := Compile(expression)
+	if err != nil {
+		return nil, err
+	}
+	return jp.Update(data, fn)
+}
+
+// Delete returns a copy of data without the values selected by a JMESPath
+// expression, along with the number of values that were removed.
+func Delete(data interface{}, expression string) (interface{}, int, error) {
+	jp, err := Compile(expression)
+	if err != nil {
+		return nil, 0, err
+	}
+	return jp.Delete(data)
+}
+
+// locations returns every location in data selected by the compiled
+// expression, including locations that don't hold a value yet.
+func (jp *JMESPath) locations(data interface{}, mode locateMode) ([]PathResult, error) {
+	if jp.ast == nil {
+		return nil, errNoExpression
+	}
+	if err := checkPathExpression(*jp.ast); err != nil {
+		return nil, err
+	}
+	result, err := jp.intr.locate(*jp.ast, located{path: Path{}, value: data}, mode)
+	if err != nil {
+		return nil, withExpression(err, jp.expression)
+	}
+	return result.leaves(nil, true), nil
+}
+
+// checkPathExpression verifies that every value node selects could be
+// traced back to a location in the input document.
+func checkPathExpression(node ASTNode) error {
+	switch node.nodeType {
+	case ASTIdentity, ASTCurrentNode, ASTField, ASTIndex, ASTSlice:
+		return nil
+	case ASTSubexpression, ASTIndexExpression, ASTProjection, ASTValueProjection, ASTFlatten:
+		for _, child := range node.children {
+			if err := checkPathExpression(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	case ASTFilterProjection:
+		// The filter condition can be any expression, it only decides
+		// which elements are selected.
+		for _, child := range node.children[:2] {
+			if err := checkPathExpression(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("jmespath: %s does not select a location in the document", node.nodeType)
+}
+
+// edit replaces the value at path, or removes it from its parent object
+// or array if remove is set.
+type edit struct {
+	path   Path
+	value  interface{}
+	remove bool
+}
+
+// editTree groups edits by the path they apply to, so that every object and
+// array on the way to an edited location is copied only once.
+type editTree struct {
+	keys     []interface{}
+	children map[interface{}]*editTree
+	edit     *edit
+}
+
+func (t *editTree) add(e *edit, path Path) {
+	if len(path) == 0 {
+		t.edit = e
+		return
+	}
+	if t.children == nil {
+		t.children = make(map[interface{}]*editTree)
+	}
+	child, ok := t.children[path[0]]
+	if !ok {
+		child = &editTree{}
+		t.children[path[0]] = child
+		t.keys = append(t.keys, path[0])
+	}
+	child.add(e, path[1:])
+}
+
+func (t *editTree) removes() bool {
+	return t.edit != nil && t.edit.remove
+}
+
+// applyEdits returns a copy of data with edits applied, along with the
+// number of values that were removed.
+func applyEdits(data interface{}, edits []edit) (interface{}, int, error) {
+	root := &editTree{}
+	for i := range edits {
+		root.add(&edits[i], edits[i].path)
+	}
+	if root.removes() {
+		return nil, 1, nil
+	}
+	removed := 0
+	result, err := root.apply(data, Path{}, &removed)
+	if err != nil {
+		return nil, 0, err
+	}
+	return result, removed, nil
+}
+
+func (t *editTree) apply(value interface{}, path Path, removed *int) (interface{}, error) {
+	if t.edit != nil {
+		return t.edit.value, nil
+	}
+	if len(t.keys) == 0 {
+		return value, nil
+	}
+	switch v := value.(type) {
+	case nil:
+		created := make(map[string]interface{}, len(t.keys))
+		for _, key := range t.keys {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("jmespath: cannot index missing array at %s", path)
+			}
+			if t.children[key].removes() {
+				continue
+			}
+			child, err := t.children[key].apply(nil, path.child(name), removed)
+			if err != nil {
+				return nil, err
+			}
+			if child == nil && t.children[key].edit == nil {
+				continue
+			}
+			created[name] = child
+		}
+		if len(created) == 0 {
+			return nil, nil
+		}
+		return created, nil
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v)+len(t.keys))
+		for key, item := range v {
+			copied[key] = item
+		}
+		for _, key := range t.keys {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("jmespath: cannot index object at %s", path)
+			}
+			old, present := v[name]
+			if t.children[key].removes() {
+				if present {
+					delete(copied, name)
+					*removed++
+				}
+				continue
+			}
+			child, err := t.children[key].apply(old, path.child(name), removed)
+			if err != nil {
+				return nil, err
+			}
+			if !present && child == nil && t.children[key].edit == nil {
+				// Nothing was created below a missing key.
+				continue
+			}
+			copied[name] = child
+		}
+		return copied, nil
+	case *OrderedMap:
+		copied := v.clone()
+		for _, key := range t.keys {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("jmespath: cannot index object at %s", path)
+			}
+			old, present := v.Get(name)
+			if t.children[key].removes() {
+				if present {
+					copied.Delete(name)
+					*removed++
+				}
+				continue
+			}
+			child, err := t.children[key].apply(old, path.child(name), removed)
+			if err != nil {
+				return nil, err
+			}
+			if !present && child == nil && t.children[key].edit == nil {
+				continue
+			}
+			copied.Set(name, child)
+		}
+		return copied, nil
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		copy(copied, v)
+		drop := make(map[int]bool)
+		for _, key := range t.keys {
+			index, ok := key.(int)
+			if !ok || index < 0 || index >= len(v) {
+				return nil, fmt.Errorf("jmespath: cannot set %v on array at %s", key, path)
+			}
+			if t.children[key].removes() {
+				drop[index] = true
+				continue
+			}
+			child, err := t.children[key].apply(v[index], path.child(index), removed)
+			if err != nil {
+				return nil, err
+			}
+			copied[index] = child
+		}
+		if len(drop) == 0 {
+			return copied, nil
+		}
+		kept := make([]interface{}, 0, len(copied)-len(drop))
+		for i, item := range copied {
+			if !drop[i] {
+				kept = append(kept, item)
+			}
+		}
+		*removed += len(drop)
+		return kept, nil
+	}
+	return nil, fmt.Errorf("jmespath: cannot modify %s at %s", describeValue(value), path)
+}
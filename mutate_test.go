@@ -0,0 +1,211 @@
+package jmespath
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jmespath/go-jmespath/internal/testify/assert"
+)
+
+var manifestFixture = []byte(`{
+	"metadata": {"name": "web", "labels": {"app": "web"}},
+	"spec": {
+		"containers": [
+			{"name": "app", "image": "web:1.0", "ports": [80, 443]},
+			{"name": "sidecar", "image": "proxy:2.1"}
+		]
+	}
+}`)
+
+func decodeManifest(t *testing.T) interface{} {
+	var data interface{}
+	assert.Nil(t, json.Unmarshal(manifestFixture, &data))
+	return data
+}
+
+func marshalString(t *testing.T, value interface{}) string {
+	encoded, err := json.Marshal(value)
+	assert.Nil(t, err)
+	return string(encoded)
+}
+
+func TestSetSingleField(t *testing.T) {
+	assert := assert.New(t)
+	data := decodeManifest(t)
+	before := marshalString(t, data)
+	updated, err := Set(data, "spec.containers[?name=='app'].image", "web:2.0")
+	assert.Nil(err)
+	result, _ := Search("spec.containers[*].image", updated)
+	assert.Equal([]interface{}{"web:2.0", "proxy:2.1"}, result)
+	// The input is left untouched.
+	assert.Equal(before, marshalString(t, data))
+}
+
+func TestSetCreatesMissingFields(t *testing.T) {
+	assert := assert.New(t)
+	updated, err := Set(decodeManifest(t), "metadata.annotations.owner", "team-a")
+	assert.Nil(err)
+	result, _ := Search("metadata.annotations", updated)
+	assert.Equal(map[string]interface{}{"owner": "team-a"}, result)
+
+	updated, err = Set(decodeManifest(t), "spec.containers[*].resources", "small")
+	assert.Nil(err)
+	result, _ = Search("spec.containers[].resources", updated)
+	assert.Equal([]interface{}{"small", "small"}, result)
+}
+
+func TestSetSharesUnchangedValues(t *testing.T) {
+	assert := assert.New(t)
+	data := decodeManifest(t).(map[string]interface{})
+	updated, err := Set(data, "metadata.name", "api")
+	assert.Nil(err)
+	spec := updated.(map[string]interface{})["spec"].(map[string]interface{})
+	spec["replicas"] = 3.0
+	_, ok := data["spec"].(map[string]interface{})["replicas"]
+	assert.True(ok, "untouched subtrees should be shared with the input")
+}
+
+func TestUpdate(t *testing.T) {
+	assert := assert.New(t)
+	updated, err := Update(decodeManifest(t), "spec.containers[].ports[]", func(old interface{}) interface{} {
+		return old.(float64) + 8000
+	})
+	assert.Nil(err)
+	result, _ := Search("spec.containers[0].ports", updated)
+	assert.Equal([]interface{}{8080.0, 8443.0}, result)
+
+	updated, err = Update(decodeManifest(t), "spec.containers[1:].image", func(old interface{}) interface{} {
+		return strings.ToUpper(old.(string))
+	})
+	assert.Nil(err)
+	result, _ = Search("spec.containers[*].image", updated)
+	assert.Equal([]interface{}{"web:1.0", "PROXY:2.1"}, result)
+
+	updated, err = Update(decodeManifest(t), "metadata.labels.*", func(old interface{}) interface{} {
+		return old.(string) + "-v2"
+	})
+	assert.Nil(err)
+	result, _ = Search("metadata.labels.app", updated)
+	assert.Equal("web-v2", result)
+}
+
+func TestSetOrderedInput(t *testing.T) {
+	assert := assert.New(t)
+	data, err := UnmarshalOrdered([]byte(`{"b": {"y": 1, "x": 2}, "a": 0}`))
+	assert.Nil(err)
+	updated, err := Set(data, "b.x", 3.0)
+	assert.Nil(err)
+	assert.Equal(`{"b":{"y":1,"x":3},"a":0}`, marshalString(t, updated))
+	assert.Equal(`{"b":{"y":1,"x":2},"a":0}`, marshalString(t, data))
+}
+
+func TestSetRejectsNonPathExpressions(t *testing.T) {
+	assert := assert.New(t)
+	data := decodeManifest(t)
+	for _, expression := range []string{
+		"length(spec.containers)",
+		"metadata | name",
+		"{name: metadata.name}",
+		"spec.containers[*].[name, image]",
+		"metadata.name || 'x'",
+	} {
+		_, err := Set(data, expression, "x")
+		assert.NotNil(err, expression)
+	}
+	_, err := Set("scalar", "@", "x")
+	assert.Nil(err)
+}
+
+func TestSetRejectsLocationsThatCannotBeCreated(t *testing.T) {
+	assert := assert.New(t)
+	data := decodeManifest(t)
+	for expression, message := range map[string]string{
+		"metadata.name.first":          `jmespath: cannot select field "first" of the string at metadata.name`,
+		"metadata.labels[0]":           "jmespath: cannot select index [0] of the object at metadata.labels",
+		"metadata.labels[*].x":         "jmespath: cannot select projection of the object at metadata.labels",
+		"metadata.name.*":              "jmespath: cannot select object projection of the string at metadata.name",
+		"nope[0]":                      "jmespath: cannot select index [0] of the missing value at nope",
+		"spec.containers[5].image":     "jmespath: cannot create element 5 of the array at spec.containers",
+		"spec.containers[*].ports[-1]": "jmespath: cannot select index [-1] of the missing value at spec.containers[1].ports",
+	} {
+		_, err := Set(data, expression, "x")
+		if assert.NotNil(err, expression) {
+			assert.Equal(message, err.Error(), expression)
+		}
+		_, err = MustCompile(expression).Patch(data, func(interface{}) interface{} { return "x" })
+		assert.NotNil(err, expression)
+		// Delete skips the locations that don't exist.
+		_, _, err = Delete(data, expression)
+		assert.Nil(err, expression)
+	}
+	// Projections over a missing value select nothing.
+	updated, err := Set(data, "nope[*].name", "x")
+	assert.Nil(err)
+	assert.Equal(marshalString(t, data), marshalString(t, updated))
+}
+
+func TestDelete(t *testing.T) {
+	assert := assert.New(t)
+	var data interface{}
+	assert.Nil(json.Unmarshal([]byte(`{
+		"items": [
+			{"id": 1, "status": "stale"},
+			{"id": 2, "status": "fresh"},
+			{"id": 3, "status": "stale"}
+		],
+		"metadata": {"annotations": {"a": "1", "b": null}, "name": "x"}
+	}`), &data))
+	before := marshalString(t, data)
+
+	pruned, removed, err := Delete(data, "items[?status=='stale']")
+	assert.Nil(err)
+	assert.Equal(2, removed)
+	result, _ := Search("items[*].id", pruned)
+	assert.Equal([]interface{}{2.0}, result)
+
+	pruned, removed, err = Delete(data, "metadata.annotations.*")
+	assert.Nil(err)
+	assert.Equal(2, removed)
+	result, _ = Search("metadata", pruned)
+	assert.Equal(map[string]interface{}{"annotations": map[string]interface{}{}, "name": "x"}, result)
+
+	pruned, removed, err = Delete(data, "items[].status")
+	assert.Nil(err)
+	assert.Equal(3, removed)
+	result, _ = Search("items[0]", pruned)
+	assert.Equal(map[string]interface{}{"id": 1.0}, result)
+
+	assert.Equal(before, marshalString(t, data))
+}
+
+func TestDeleteMissingValues(t *testing.T) {
+	assert := assert.New(t)
+	data := decodeManifest(t)
+	pruned, removed, err := Delete(data, "metadata.annotations.owner")
+	assert.Nil(err)
+	assert.Equal(0, removed)
+	assert.Equal(marshalString(t, data), marshalString(t, pruned))
+
+	pruned, removed, err = Delete(data, "spec.containers[*].ports[-1]")
+	assert.Nil(err)
+	assert.Equal(1, removed)
+	result, _ := Search("spec.containers[0].ports", pruned)
+	assert.Equal([]interface{}{80.0}, result)
+}
+
+func TestDeleteOrderedInput(t *testing.T) {
+	assert := assert.New(t)
+	data, err := UnmarshalOrdered([]byte(`{"c": 1, "secret": "x", "a": [1, 2, 3]}`))
+	assert.Nil(err)
+	pruned, removed, err := Delete(data, "[secret, a]")
+	assert.NotNil(err)
+	pruned, removed, err = Delete(data, "secret")
+	assert.Nil(err)
+	assert.Equal(1, removed)
+	assert.Equal(`{"c":1,"a":[1,2,3]}`, marshalString(t, pruned))
+	pruned, removed, err = Delete(pruned, "a[::2]")
+	assert.Nil(err)
+	assert.Equal(2, removed)
+	assert.Equal(`{"c":1,"a":[2]}`, marshalString(t, pruned))
+}
@@ -0,0 +1,294 @@
+package jmespath
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// OrderedMap is a JSON object that remembers the order in which its keys
+// were inserted.  It can be used as input data in place of a
+// map[string]interface{} when the order of an object's keys matters,
+// for instance when it was decoded with UnmarshalOrdered.  An OrderedMap
+// is marshalled to JSON with its keys in insertion order.
+type OrderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// NewOrderedMap creates an empty OrderedMap.
+func NewOrderedMap() *OrderedMap {
+	return &OrderedMap{values: make(map[string]interface{})}
+}
+
+// Len returns the number of keys in the map.
+func (m *OrderedMap) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.keys)
+}
+
+// Keys returns the keys of the map in insertion order.
+func (m *OrderedMap) Keys() []string {
+	if m == nil {
+		return nil
+	}
+	keys := make([]string, len(m.keys))
+	copy(keys, m.keys)
+	return keys
+}
+
+// Get returns the value stored under key and whether the key was present.
+func (m *OrderedMap) Get(key string) (interface{}, bool) {
+	if m == nil {
+		return nil, false
+	}
+	value, ok := m.values[key]
+	return value, ok
+}
+
+// Set stores value under key.  A new key is added after all existing keys,
+// while setting an existing key keeps its original position.
+func (m *OrderedMap) Set(key string, value interface{}) {
+	if m.values == nil {
+		m.values = make(map[string]interface{})
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// Delete removes key from the map, if present.
+func (m *OrderedMap) Delete(key string) {
+	if _, ok := m.values[key]; !ok {
+		return
+	}
+	delete(m.values, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i:i], m.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// clone returns a shallow copy of the map.
+func (m *OrderedMap) clone() *OrderedMap {
+	copied := &OrderedMap{
+		keys:   make([]string, len(m.keys)),
+		values: make(map[string]interface{}, len(m.values)),
+	}
+	copy(copied.keys, m.keys)
+	for key, value := range m.values {
+		copied.values[key] = value
+	}
+	return copied
+}
+
+// MarshalJSON encodes the map as a JSON object with its keys in insertion
+// order.
+func (m *OrderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(encodedKey)
+		buf.WriteByte(':')
+		encodedValue, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(encodedValue)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// String returns the JSON encoding of the map.
+func (m *OrderedMap) String() string {
+	encoded, err := m.MarshalJSON()
+	if err != nil {
+		return fmt.Sprintf("%v", m.values)
+	}
+	return string(encoded)
+}
+
+// UnmarshalJSON decodes a JSON object into the map, preserving the order of
+// its keys.  Nested objects are decoded as *OrderedMap as well.
+func (m *OrderedMap) UnmarshalJSON(data []byte) error {
+	decoded, err := UnmarshalOrdered(data)
+	if err != nil {
+		return err
+	}
+	object, ok := decoded.(*OrderedMap)
+	if !ok {
+		return errors.New("jmespath: cannot unmarshal non-object JSON into OrderedMap")
+	}
+	*m = *object
+	return nil
+}
+
+// UnmarshalOrdered decodes a JSON document like json.Unmarshal into an
+// interface{} would, except that objects are decoded as *OrderedMap so that
+// the order of their keys is kept.
+func UnmarshalOrdered(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	value, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("jmespath: invalid data after top-level JSON value")
+	}
+	return value, nil
+}
+
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		object := NewOrderedMap()
+		for dec.More() {
+			keyToken, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			object.Set(keyToken.(string), value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return object, nil
+	case json.Delim('['):
+		array := []interface{}{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return array, nil
+	}
+	return tok, nil
+}
+
+// isObject reports whether value is a JSON object, either a
+// map[string]interface{} or an *OrderedMap.
+func isObject(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, *OrderedMap:
+		return true
+	}
+	return false
+}
+
+// objectLen returns the number of keys in the JSON object value.
+func objectLen(value interface{}) int {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return len(v)
+	case *OrderedMap:
+		return v.Len()
+	}
+	return 0
+}
+
+// objectGet returns the value stored under key in the JSON object value.
+func objectGet(value interface{}, key string) interface{} {
+	result, _ := objectLookup(value, key)
+	return result
+}
+
+// objectLookup is like objectGet but also reports whether key was present.
+func objectLookup(value interface{}, key string) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result, ok := v[key]
+		return result, ok
+	case *OrderedMap:
+		return v.Get(key)
+	}
+	return nil, false
+}
+
+// objectKeys returns the keys of the JSON object value in the order they
+// should be visited.  An *OrderedMap is visited in insertion order and a
+// map[string]interface{} in sorted order if sortKeys is set, and in Go's
+// unspecified map order otherwise.
+func objectKeys(value interface{}, sortKeys bool) []string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		if sortKeys {
+			sort.Strings(keys)
+		}
+		return keys
+	case *OrderedMap:
+		return v.Keys()
+	}
+	return nil
+}
+
+// containsObject reports whether value is, or contains, a JSON object.
+func containsObject(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}, *OrderedMap:
+		return true
+	case []interface{}:
+		for _, item := range v {
+			if containsObject(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unorderedJSON returns value with every *OrderedMap it contains replaced
+// by an equivalent map[string]interface{}.  Values without objects are
+// returned as is.
+func unorderedJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *OrderedMap:
+		plain := make(map[string]interface{}, v.Len())
+		for _, key := range v.keys {
+			plain[key] = unorderedJSON(v.values[key])
+		}
+		return plain
+	case []interface{}:
+		if !containsObject(v) {
+			return v
+		}
+		plain := make([]interface{}, len(v))
+		for i, item := range v {
+			plain[i] = unorderedJSON(item)
+		}
+		return plain
+	}
+	return value
+}
@@ -0,0 +1,159 @@
+package jmespath
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/jmespath/go-jmespath/internal/testify/assert"
+)
+
+func TestUnmarshalOrderedKeepsKeyOrder(t *testing.T) {
+	assert := assert.New(t)
+	data, err := UnmarshalOrdered([]byte(`{"b": 1, "a": {"z": true, "y": null}, "c": [{"k": "v"}]}`))
+	assert.Nil(err)
+	object, ok := data.(*OrderedMap)
+	if assert.True(ok) {
+		assert.Equal([]string{"b", "a", "c"}, object.Keys())
+		nested, _ := object.Get("a")
+		assert.Equal([]string{"z", "y"}, nested.(*OrderedMap).Keys())
+	}
+	encoded, err := json.Marshal(data)
+	assert.Nil(err)
+	assert.Equal(`{"b":1,"a":{"z":true,"y":null},"c":[{"k":"v"}]}`, string(encoded))
+}
+
+func TestUnmarshalOrderedRejectsTrailingData(t *testing.T) {
+	assert := assert.New(t)
+	_, err := UnmarshalOrdered([]byte(`{"a": 1} {"b": 2}`))
+	assert.NotNil(err)
+	_, err = UnmarshalOrdered([]byte(`{"a": `))
+	assert.NotNil(err)
+}
+
+func TestOrderedMapSetAndDelete(t *testing.T) {
+	assert := assert.New(t)
+	m := NewOrderedMap()
+	m.Set("one", 1.0)
+	m.Set("two", 2.0)
+	m.Set("three", 3.0)
+	m.Set("one", 4.0)
+	m.Delete("two")
+	assert.Equal([]string{"one", "three"}, m.Keys())
+	value, ok := m.Get("one")
+	assert.True(ok)
+	assert.Equal(4.0, value)
+	_, ok = m.Get("two")
+	assert.False(ok)
+}
+
+func TestOrderedMapUnmarshalJSON(t *testing.T) {
+	assert := assert.New(t)
+	var m OrderedMap
+	err := json.Unmarshal([]byte(`{"second": 2, "first": 1}`), &m)
+	assert.Nil(err)
+	assert.Equal([]string{"second", "first"}, m.Keys())
+	err = json.Unmarshal([]byte(`[1, 2]`), &m)
+	assert.NotNil(err)
+}
+
+func TestSearchOrderedInput(t *testing.T) {
+	assert := assert.New(t)
+	data, err := UnmarshalOrdered([]byte(`{"foo": {"c": 3, "a": 1, "b": 2}}`))
+	assert.Nil(err)
+	for expression, expected := range map[string]interface{}{
+		"keys(foo)":   []interface{}{"c", "a", "b"},
+		"values(foo)": []interface{}{3.0, 1.0, 2.0},
+		"foo.*":       []interface{}{3.0, 1.0, 2.0},
+		"foo.a":       1.0,
+		"length(foo)": 3.0,
+		"type(foo)":   "object",
+		"foo == `{\"a\": 1, \"b\": 2, \"c\": 3}`": true,
+		"merge(foo, `{\"d\": 4}`).d":              4.0,
+	} {
+		result, err := Search(expression, data)
+		assert.Nil(err, expression)
+		assert.Equal(expected, result, expression)
+	}
+}
+
+func TestSortKeysOption(t *testing.T) {
+	assert := assert.New(t)
+	var data interface{}
+	err := json.Unmarshal([]byte(`{"foo": {"e": 5, "c": 3, "a": 1, "d": 4, "b": 2}}`), &data)
+	assert.Nil(err)
+	for expression, expected := range map[string]interface{}{
+		"keys(foo)":   []interface{}{"a", "b", "c", "d", "e"},
+		"values(foo)": []interface{}{1.0, 2.0, 3.0, 4.0, 5.0},
+		"foo.*":       []interface{}{1.0, 2.0, 3.0, 4.0, 5.0},
+	} {
+		jp := MustCompile(expression)
+		jp.SetOptions(Options{SortKeys: true})
+		result, err := jp.Search(data)
+		assert.Nil(err, expression)
+		assert.Equal(expected, result, expression)
+	}
+}
+
+func TestExportedKeysAndValues(t *testing.T) {
+	assert := assert.New(t)
+	result, err := JPfKeys([]interface{}{map[string]interface{}{"a": 1.0}})
+	assert.Nil(err)
+	assert.Equal([]interface{}{"a"}, result)
+	result, err = JPfValues([]interface{}{map[string]interface{}{"a": 1.0}})
+	assert.Nil(err)
+	assert.Equal([]interface{}{1.0}, result)
+	ordered, err := UnmarshalOrdered([]byte(`{"b": 2, "a": 1}`))
+	assert.Nil(err)
+	result, err = JPfKeys([]interface{}{ordered})
+	assert.Nil(err)
+	assert.Equal([]interface{}{"b", "a"}, result)
+}
+
+func TestPreserveOrderOption(t *testing.T) {
+	assert := assert.New(t)
+	data, err := UnmarshalOrdered([]byte(`{"x": {"b": 2, "a": 1}, "y": "why"}`))
+	assert.Nil(err)
+	for expression, expected := range map[string]string{
+		"{zeta: y, alpha: x.a, mid: x.b}":        `{"zeta":"why","alpha":1,"mid":2}`,
+		"merge(x, `{\"c\": 3, \"a\": 0}`)":       `{"b":2,"a":0,"c":3}`,
+		"`{\"second\": 2, \"first\": 1}`":        `{"second":2,"first":1}`,
+		"[`{\"z\": {\"y\": 1, \"x\": 2}}`][0].z": `{"y":1,"x":2}`,
+	} {
+		jp := MustCompile(expression)
+		jp.SetOptions(Options{PreserveOrder: true})
+		result, err := jp.Search(data)
+		assert.Nil(err, expression)
+		encoded, err := json.Marshal(result)
+		assert.Nil(err, expression)
+		assert.Equal(expected, string(encoded), expression)
+	}
+}
+
+func TestExportedMerge(t *testing.T) {
+	assert := assert.New(t)
+	result, err := JPfMerge([]interface{}{
+		map[string]interface{}{"a": 1.0, "b": 1.0},
+		map[string]interface{}{"b": 2.0},
+	})
+	assert.Nil(err)
+	assert.Equal(map[string]interface{}{"a": 1.0, "b": 2.0}, result)
+}
+
+func TestObjectLiteralsArePlainMapsByDefault(t *testing.T) {
+	assert := assert.New(t)
+	result, err := Search("`{\"b\": [{\"c\": 1}]}`", nil)
+	assert.Nil(err)
+	assert.Equal(map[string]interface{}{"b": []interface{}{map[string]interface{}{"c": 1.0}}}, result)
+	result, err = Search("{b: b, a: a}", map[string]interface{}{"a": 1.0, "b": 2.0})
+	assert.Nil(err)
+	assert.Equal(map[string]interface{}{"a": 1.0, "b": 2.0}, result)
+	result, err = Search("`[1, \"a\"]`", nil)
+	assert.Nil(err)
+	assert.Equal([]interface{}{1.0, "a"}, result)
+	// The plain form is built once, when the expression is parsed.
+	jp := MustCompile("`{\"a\": 1}`")
+	first, _ := jp.Search(nil)
+	second, _ := jp.Search(nil)
+	assert.Equal(reflect.ValueOf(first).Pointer(), reflect.ValueOf(second).Pointer())
+}
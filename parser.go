@@ -1,7 +1,6 @@
 package jmespath
 
 import (
-	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -41,6 +40,8 @@ type ASTNode struct {
 	nodeType astNodeType
 	value    interface{}
 	children []ASTNode
+	offset   int         // Position in the expression of the token the node starts at
+	ordered  interface{} // Value of a JSON literal with objects as *OrderedMap
 }
 
 func (node ASTNode) String() string {
@@ -150,13 +151,16 @@ func (p *Parser) parseExpression(bindingPower int) (ASTNode, error) {
 	if err != nil {
 		return ASTNode{}, err
 	}
+	leftNode.offset = leftToken.position
 	currentToken := p.current()
 	for bindingPower < bindingPowers[currentToken] {
+		offset := p.lookaheadToken(0).position
 		p.advance()
 		leftNode, err = p.led(currentToken, leftNode)
 		if err != nil {
 			return ASTNode{}, err
 		}
+		leftNode.offset = offset
 		currentToken = p.current()
 	}
 	return leftNode, nil
@@ -171,7 +175,7 @@ func (p *Parser) parseIndexExpression() (ASTNode, error) {
 	if err != nil {
 		return ASTNode{}, err
 	}
-	indexNode := ASTNode{nodeType: ASTIndex, value: parsedInt}
+	indexNode := ASTNode{nodeType: ASTIndex, value: parsedInt, offset: p.lookaheadToken(-1).position}
 	p.advance()
 	if err := p.match(tRbracket); err != nil {
 		return ASTNode{}, err
@@ -182,6 +186,7 @@ func (p *Parser) parseIndexExpression() (ASTNode, error) {
 func (p *Parser) parseSliceExpression() (ASTNode, error) {
 	parts := []*int{nil, nil, nil}
 	index := 0
+	offset := p.lookaheadToken(-1).position
 	current := p.current()
 	for current != tRbracket && index < 3 {
 		if current == tColon {
@@ -206,6 +211,7 @@ func (p *Parser) parseSliceExpression() (ASTNode, error) {
 	return ASTNode{
 		nodeType: ASTSlice,
 		value:    parts,
+		offset:   offset,
 	}, nil
 }
 
@@ -268,7 +274,11 @@ func (p *Parser) led(tokenType tokType, node ASTNode) (ASTNode, error) {
 	case tFilter:
 		return p.parseFilter(node)
 	case tFlatten:
-		left := ASTNode{nodeType: ASTFlatten, children: []ASTNode{node}}
+		left := ASTNode{
+			nodeType: ASTFlatten,
+			children: []ASTNode{node},
+			offset:   p.lookaheadToken(-1).position,
+		}
 		right, err := p.parseProjectionRHS(bindingPowers[tFlatten])
 		return ASTNode{
 			nodeType: ASTProjection,
@@ -317,12 +327,16 @@ func (p *Parser) led(tokenType tokType, node ASTNode) (ASTNode, error) {
 func (p *Parser) nud(token token) (ASTNode, error) {
 	switch token.tokenType {
 	case tJSONLiteral:
-		var parsed interface{}
-		err := json.Unmarshal([]byte(token.value), &parsed)
+		parsed, err := UnmarshalOrdered([]byte(token.value))
 		if err != nil {
 			return ASTNode{}, err
 		}
-		return ASTNode{nodeType: ASTLiteral, value: parsed}, nil
+		if !containsObject(parsed) {
+			return ASTNode{nodeType: ASTLiteral, value: parsed}, nil
+		}
+		// Keep both forms of object literals, the interpreter uses the
+		// ordered one for Options.PreserveOrder.
+		return ASTNode{nodeType: ASTLiteral, value: unorderedJSON(parsed), ordered: parsed}, nil
 	case tStringLiteral:
 		return ASTNode{nodeType: ASTLiteral, value: token.value}, nil
 	case tUnquotedIdentifier:
@@ -354,6 +368,7 @@ func (p *Parser) nud(token token) (ASTNode, error) {
 		left := ASTNode{
 			nodeType: ASTFlatten,
 			children: []ASTNode{{nodeType: ASTIdentity}},
+			offset:   token.position,
 		}
 		right, err := p.parseProjectionRHS(bindingPowers[tFlatten])
 		if err != nil {
@@ -499,6 +514,7 @@ func (p *Parser) projectIfSlice(left ASTNode, right ASTNode) (ASTNode, error) {
 func (p *Parser) parseFilter(node ASTNode) (ASTNode, error) {
 	var right, condition ASTNode
 	var err error
+	offset := p.lookaheadToken(-1).position
 	condition, err = p.parseExpression(0)
 	if err != nil {
 		return ASTNode{}, err
@@ -518,6 +534,7 @@ func (p *Parser) parseFilter(node ASTNode) (ASTNode, error) {
 	return ASTNode{
 		nodeType: ASTFilterProjection,
 		children: []ASTNode{node, right, condition},
+		offset:   offset,
 	}, nil
 }
 
@@ -0,0 +1,160 @@
+package jmespath
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// PatchOperation is a single RFC 6902 JSON Patch operation.  Patch only
+// produces "add", "remove" and "replace" operations.
+type PatchOperation struct {
+	Op    string
+	Path  string // JSON Pointer to the modified location
+	Value interface{}
+}
+
+// MarshalJSON encodes the operation the way RFC 6902 describes it, leaving
+// out the value of "remove" operations.
+func (op PatchOperation) MarshalJSON() ([]byte, error) {
+	if op.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{op.Op, op.Path})
+	}
+	return json.Marshal(struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	}{op.Op, op.Path, op.Value})
+}
+
+type removeMarker struct{}
+
+// Remove can be returned by the function passed to Update or Patch to
+// remove a selected value instead of replacing it.
+var Remove interface{} = &removeMarker{}
+
+// Patch describes, as a JSON Patch, the edit that replacing every value
+// selected by the compiled expression with the result of calling fn on it
+// would make to data.  The expression is restricted in the same way as
+// for Set.  Values that fn leaves unchanged don't produce an operation,
+// and fn can return Remove to delete a value.  The input is not modified.
+//
+// The operations are ordered so that they can be applied in sequence:
+// additions and replacements come first, followed by removals, which are
+// ordered so that removing an array element doesn't shift the index of
+// one that is removed later.
+func (jp *JMESPath) Patch(data interface{}, fn func(old interface{}) interface{}) ([]PatchOperation, error) {
+	locations, err := jp.locations(data, createLocations)
+	if err != nil {
+		return nil, err
+	}
+	edits := make([]edit, len(locations))
+	for i, location := range locations {
+		value := fn(location.Value)
+		edits[i] = edit{path: location.Path, value: value, remove: value == Remove}
+	}
+	updated, _, err := applyEdits(data, edits)
+	if err != nil {
+		return nil, err
+	}
+	operations := []PatchOperation{}
+	added := make(map[string]bool)
+	var removals []Path
+	for _, e := range edits {
+		old, exists := lookupPath(data, e.path)
+		if e.remove {
+			if exists {
+				removals = append(removals, e.path)
+			}
+			continue
+		}
+		if exists {
+			if !objsEqual(old, e.value) {
+				operations = append(operations, PatchOperation{Op: "replace", Path: e.path.JSONPointer(), Value: e.value})
+			}
+			continue
+		}
+		// Add the outermost value that doesn't exist yet, which may be
+		// an intermediate object created on the way to the location.
+		created := e.path
+		for i := range e.path {
+			if _, ok := lookupPath(data, e.path[:i+1]); !ok {
+				created = e.path[:i+1]
+				break
+			}
+		}
+		pointer := created.JSONPointer()
+		if added[pointer] {
+			continue
+		}
+		added[pointer] = true
+		value, _ := lookupPath(updated, created)
+		operations = append(operations, PatchOperation{Op: "add", Path: pointer, Value: value})
+	}
+	sort.SliceStable(removals, func(i, j int) bool {
+		return comparePaths(removals[i], removals[j]) > 0
+	})
+	for _, path := range removals {
+		operations = append(operations, PatchOperation{Op: "remove", Path: path.JSONPointer()})
+	}
+	return operations, nil
+}
+
+// Patch returns the JSON Patch operations that replacing every value
+// selected by a JMESPath expression with the result of calling fn on it
+// would apply to data.
+func Patch(data interface{}, expression string, fn func(old interface{}) interface{}) ([]PatchOperation, error) {
+	jp, err := Compile(expression)
+	if err != nil {
+		return nil, err
+	}
+	return jp.Patch(data, fn)
+}
+
+// lookupPath returns the value at path in data and whether it exists.
+func lookupPath(data interface{}, path Path) (interface{}, bool) {
+	current := data
+	for _, part := range path {
+		switch key := part.(type) {
+		case string:
+			value, ok := objectLookup(current, key)
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case int:
+			array, ok := current.([]interface{})
+			if !ok || key < 0 || key >= len(array) {
+				return nil, false
+			}
+			current = array[key]
+		}
+	}
+	return current, true
+}
+
+// comparePaths orders paths element by element, comparing array indices
+// numerically.  A path sorts before the paths it is a prefix of.
+func comparePaths(a, b Path) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		switch left := a[i].(type) {
+		case int:
+			if right, ok := b[i].(int); ok && left != right {
+				if left < right {
+					return -1
+				}
+				return 1
+			}
+		case string:
+			if right, ok := b[i].(string); ok && left != right {
+				if left < right {
+					return -1
+				}
+				return 1
+			}
+		}
+	}
+	return len(a) - len(b)
+}
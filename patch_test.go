@@ -0,0 +1,89 @@
+package jmespath
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jmespath/go-jmespath/internal/testify/assert"
+)
+
+func TestPatchReplace(t *testing.T) {
+	assert := assert.New(t)
+	data := decodeManifest(t)
+	operations, err := Patch(data, "spec.containers[*].image", func(old interface{}) interface{} {
+		if strings.HasPrefix(old.(string), "web:") {
+			return "web:2.0"
+		}
+		return old
+	})
+	assert.Nil(err)
+	assert.Equal(`[{"op":"replace","path":"/spec/containers/0/image","value":"web:2.0"}]`, marshalString(t, operations))
+}
+
+func TestPatchAddsMissingValues(t *testing.T) {
+	assert := assert.New(t)
+	data := decodeManifest(t)
+	operations, err := Patch(data, "metadata.labels.tier", func(interface{}) interface{} {
+		return "frontend"
+	})
+	assert.Nil(err)
+	assert.Equal(`[{"op":"add","path":"/metadata/labels/tier","value":"frontend"}]`, marshalString(t, operations))
+
+	operations, err = Patch(data, "spec.containers[*].resources.limits", func(interface{}) interface{} {
+		return nil
+	})
+	assert.Nil(err)
+	assert.Equal(`[`+
+		`{"op":"add","path":"/spec/containers/0/resources","value":{"limits":null}},`+
+		`{"op":"add","path":"/spec/containers/1/resources","value":{"limits":null}}]`,
+		marshalString(t, operations))
+}
+
+func TestPatchRemoveOrdering(t *testing.T) {
+	assert := assert.New(t)
+	var data interface{}
+	assert.Nil(json.Unmarshal([]byte(`{"items": [
+		{"id": 1, "stale": true}, {"id": 2}, {"id": 3, "stale": true}
+	], "count": 3}`), &data))
+	operations, err := Patch(data, "items[?stale]", func(interface{}) interface{} {
+		return Remove
+	})
+	assert.Nil(err)
+	assert.Equal(`[{"op":"remove","path":"/items/2"},{"op":"remove","path":"/items/0"}]`, marshalString(t, operations))
+
+	operations, err = Patch(data, "items[?stale].id", func(old interface{}) interface{} {
+		return Remove
+	})
+	assert.Nil(err)
+	assert.Equal(`[{"op":"remove","path":"/items/2/id"},{"op":"remove","path":"/items/0/id"}]`, marshalString(t, operations))
+}
+
+func TestPatchMatchesUpdate(t *testing.T) {
+	assert := assert.New(t)
+	data := decodeManifest(t)
+	double := func(old interface{}) interface{} {
+		if old.(float64) == 443 {
+			return Remove
+		}
+		return old.(float64) * 2
+	}
+	operations, err := Patch(data, "spec.containers[].ports[]", double)
+	assert.Nil(err)
+	assert.Equal(`[`+
+		`{"op":"replace","path":"/spec/containers/0/ports/0","value":160},`+
+		`{"op":"remove","path":"/spec/containers/0/ports/1"}]`,
+		marshalString(t, operations))
+	updated, err := Update(data, "spec.containers[].ports[]", double)
+	assert.Nil(err)
+	result, _ := Search("spec.containers[0].ports", updated)
+	assert.Equal([]interface{}{160.0}, result)
+}
+
+func TestPatchRejectsNonPathExpressions(t *testing.T) {
+	assert := assert.New(t)
+	_, err := Patch(decodeManifest(t), "keys(metadata)", func(old interface{}) interface{} {
+		return old
+	})
+	assert.NotNil(err)
+}
@@ -0,0 +1,398 @@
+package jmespath
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Path is the location of a value inside a document.  Each element is
+// either an object key (a string) or an array index (an int).
+type Path []interface{}
+
+// String renders the path as a JMESPath expression, such as
+// "reservations[0].instances[3].id".  The path of the document itself
+// is rendered as "@".
+func (p Path) String() string {
+	if len(p) == 0 {
+		return "@"
+	}
+	var buf strings.Builder
+	for i, part := range p {
+		switch v := part.(type) {
+		case int:
+			buf.WriteString("[" + strconv.Itoa(v) + "]")
+		case string:
+			if i == 0 && isIdentifier(v) {
+				buf.WriteString(v)
+			} else if i == 0 {
+				buf.WriteString(strconv.Quote(v))
+			} else {
+				buf.WriteString(fieldPath(v))
+			}
+		}
+	}
+	return buf.String()
+}
+
+// JSONPointer renders the path as an RFC 6901 JSON Pointer, such as
+// "/reservations/0/instances/3/id".
+func (p Path) JSONPointer() string {
+	var buf strings.Builder
+	for _, part := range p {
+		buf.WriteByte('/')
+		switch v := part.(type) {
+		case int:
+			buf.WriteString(strconv.Itoa(v))
+		case string:
+			v = strings.Replace(v, "~", "~0", -1)
+			v = strings.Replace(v, "/", "~1", -1)
+			buf.WriteString(v)
+		}
+	}
+	return buf.String()
+}
+
+func (p Path) child(part interface{}) Path {
+	if p == nil {
+		return nil
+	}
+	extended := make(Path, len(p), len(p)+1)
+	copy(extended, p)
+	return append(extended, part)
+}
+
+// PathResult is a single value matched by SearchWithPaths along with its
+// location in the input document.
+type PathResult struct {
+	// Path is the location of Value in the input.
+	Path  Path
+	Value interface{}
+}
+
+// SearchWithPaths evaluates the compiled expression against data like
+// Search does, but instead of a single result it returns every value the
+// expression selected together with where it was found.  Projections,
+// filters and flatten expressions report each of their elements
+// separately.  Null values are left out, just like projections leave
+// them out of their results, and so are values that don't exist in the
+// input because the expression computed them, for example with a
+// function call or a multi-select: "length(items)" and "[items[0]]"
+// select nothing.
+func (jp *JMESPath) SearchWithPaths(data interface{}) ([]PathResult, error) {
+	if jp.ast == nil {
+		return nil, errNoExpression
+	}
+	result, err := jp.intr.locate(*jp.ast, located{path: Path{}, value: data}, findValues)
+	if err != nil {
+		return nil, withExpression(err, jp.expression)
+	}
+	return result.leaves(nil, false), nil
+}
+
+// SearchWithPaths evaluates a JMESPath expression against input data and
+// returns the selected values along with their locations.
+func SearchWithPaths(expression string, data interface{}) ([]PathResult, error) {
+	jp, err := Compile(expression)
+	if err != nil {
+		return nil, err
+	}
+	return jp.SearchWithPaths(data)
+}
+
+// located is an intermediate result of treeInterpreter.locate.  A value
+// taken from the input document carries its path, while a value computed
+// by the expression has a nil path.  The list built by a projection has no
+// path of its own either, but remembers the located elements it was
+// collected from so later steps can keep tracking them.  A field that
+// doesn't exist in the input is marked as missing.
+type located struct {
+	path      Path
+	value     interface{}
+	missing   bool
+	projected bool
+	elements  []located
+}
+
+// leaves appends the values l is made of to results, looking through the
+// lists built by projections.  Values without a location in the input are
+// skipped, and so are null values unless keepMissing is set.
+func (l located) leaves(results []PathResult, keepMissing bool) []PathResult {
+	if l.projected {
+		for _, element := range l.elements {
+			results = element.leaves(results, keepMissing)
+		}
+		return results
+	}
+	if l.path == nil || (l.value == nil && !keepMissing) {
+		return results
+	}
+	return append(results, PathResult{Path: l.path, Value: l.value})
+}
+
+// arrayElements returns the elements of current if it is an array.
+func (l located) arrayElements() ([]located, bool) {
+	if l.projected {
+		return l.elements, true
+	}
+	if !isSliceType(l.value) {
+		return nil, false
+	}
+	rv := reflect.ValueOf(l.value)
+	elements := make([]located, rv.Len())
+	for i := range elements {
+		elements[i] = located{path: l.path.child(i), value: rv.Index(i).Interface()}
+	}
+	return elements, true
+}
+
+func projection(elements []located) located {
+	values := make([]interface{}, len(elements))
+	for i, element := range elements {
+		values[i] = element.value
+	}
+	return located{value: values, projected: true, elements: elements}
+}
+
+// locateMode is what treeInterpreter.locate is looking for.
+type locateMode int
+
+const (
+	// findValues finds the values that exist in the input, for
+	// SearchWithPaths.
+	findValues locateMode = iota
+	// findLocations also keeps the locations of null and missing values,
+	// for Delete.
+	findLocations
+	// createLocations also keeps the locations of null and missing
+	// values, and fails for locations that can't be created, such as a
+	// field of a number or an element of an array that doesn't exist, so
+	// that Set and Update don't quietly leave the document unchanged.
+	createLocations
+)
+
+// locate evaluates node against current the same way Execute does, while
+// keeping track of where in the input document each value came from.  Only
+// the parts of the grammar that select values from the input (fields,
+// indices, slices, projections, filters, flattens, pipes, "||" and "&&")
+// produce paths; everything else is evaluated by Execute.  The nodes that
+// produce paths are evaluated with the helpers Execute uses for them, so
+// that both agree on the values selected and on the errors reported, for
+// instance in strict mode.  The mode decides what happens to locations
+// without a value and to locations that can't be walked through.
+func (intr *treeInterpreter) locate(node ASTNode, current located, mode locateMode) (located, error) {
+	switch node.nodeType {
+	case ASTIdentity, ASTCurrentNode:
+		return current, nil
+	case ASTField:
+		value, err := intr.Execute(node, current.value)
+		if err != nil {
+			return located{}, err
+		}
+		key := node.value.(string)
+		if current.projected {
+			return located{}, nil
+		}
+		if current.value == nil || isObject(current.value) {
+			_, present := objectLookup(current.value, key)
+			return located{path: current.path.child(key), value: value, missing: !present}, nil
+		}
+		if isStructType(current.value) {
+			return located{path: current.path.child(key), value: value}, nil
+		}
+		return located{value: value}, walkError(node, current, mode)
+	case ASTIndex:
+		elements, ok := current.arrayElements()
+		if !ok {
+			if err := intr.strictError(node, current.value, "an array"); err != nil {
+				return located{}, err
+			}
+			return located{}, walkError(node, current, mode)
+		}
+		index, ok := indexPosition(node, len(elements))
+		if !ok {
+			if mode == createLocations && current.path != nil {
+				return located{}, fmt.Errorf("jmespath: cannot create element %d of the array at %s", node.value, current.path)
+			}
+			return located{}, nil
+		}
+		return elements[index], nil
+	case ASTSlice:
+		elements, ok := current.arrayElements()
+		if !ok {
+			if err := intr.strictError(node, current.value, "an array"); err != nil {
+				return located{}, err
+			}
+			return located{}, walkError(node, current, mode)
+		}
+		positions, err := slicePositions(len(elements), sliceParams(node))
+		if err != nil {
+			return located{}, err
+		}
+		sliced := make([]located, len(positions))
+		for i, position := range positions {
+			sliced[i] = elements[position]
+		}
+		return projection(sliced), nil
+	case ASTSubexpression, ASTIndexExpression:
+		left, err := intr.locate(node.children[0], current, mode)
+		if err != nil {
+			return located{}, err
+		}
+		return intr.locate(node.children[1], left, mode)
+	case ASTPipe:
+		result := current
+		var err error
+		for _, child := range node.children {
+			result, err = intr.locate(child, result, mode)
+			if err != nil {
+				return located{}, err
+			}
+		}
+		return result, nil
+	case ASTProjection:
+		left, err := intr.locate(node.children[0], current, mode)
+		if err != nil {
+			return located{}, err
+		}
+		elements, ok := left.arrayElements()
+		if !ok {
+			if err := intr.strictError(node, left.value, "an array"); err != nil {
+				return located{}, err
+			}
+			return located{}, walkError(node, left, mode)
+		}
+		return intr.projectLocated(node.children[1], elements, mode)
+	case ASTFilterProjection:
+		left, err := intr.locate(node.children[0], current, mode)
+		if err != nil {
+			return located{}, intr.leftError(err)
+		}
+		elements, ok := left.arrayElements()
+		if !ok {
+			if err := intr.strictError(node, left.value, "an array"); err != nil {
+				return located{}, err
+			}
+			return located{}, walkError(node, left, mode)
+		}
+		matched := []located{}
+		for _, element := range elements {
+			ok, err := intr.matchesFilter(node, element.value)
+			if err != nil {
+				return located{}, err
+			}
+			if ok {
+				matched = append(matched, element)
+			}
+		}
+		return intr.projectLocated(node.children[1], matched, mode)
+	case ASTFlatten:
+		left, err := intr.locate(node.children[0], current, mode)
+		if err != nil {
+			return located{}, intr.leftError(err)
+		}
+		elements, ok := left.arrayElements()
+		if !ok {
+			if err := intr.strictError(node, left.value, "an array"); err != nil {
+				return located{}, err
+			}
+			return located{}, walkError(node, left, mode)
+		}
+		flattened := []located{}
+		for _, element := range elements {
+			if element.missing {
+				continue
+			}
+			if inner, ok := element.arrayElements(); ok {
+				flattened = append(flattened, inner...)
+			} else {
+				flattened = append(flattened, element)
+			}
+		}
+		return projection(flattened), nil
+	case ASTValueProjection:
+		left, err := intr.locate(node.children[0], current, mode)
+		if err != nil {
+			return located{}, intr.leftError(err)
+		}
+		if left.projected || !isObject(left.value) {
+			if err := intr.strictError(node, left.value, "an object"); err != nil {
+				return located{}, err
+			}
+			return located{}, walkError(node, left, mode)
+		}
+		keys := objectKeys(left.value, intr.opts.SortKeys)
+		elements := make([]located, len(keys))
+		for i, key := range keys {
+			elements[i] = located{path: left.path.child(key), value: objectGet(left.value, key)}
+		}
+		return intr.projectLocated(node.children[1], elements, mode)
+	case ASTOrExpression:
+		matched, err := intr.locate(node.children[0], current, mode)
+		if err != nil {
+			return located{}, err
+		}
+		if isFalse(matched.value) {
+			return intr.locate(node.children[1], current, mode)
+		}
+		return matched, nil
+	case ASTAndExpression:
+		matched, err := intr.locate(node.children[0], current, mode)
+		if err != nil {
+			return located{}, err
+		}
+		if isFalse(matched.value) {
+			return matched, nil
+		}
+		return intr.locate(node.children[1], current, mode)
+	}
+	value, err := intr.Execute(node, current.value)
+	if err != nil {
+		return located{}, err
+	}
+	return located{value: value}, nil
+}
+
+// projectLocated applies node to each element the way a projection does,
+// dropping null results unless mode keeps them and their location is
+// known.
+func (intr *treeInterpreter) projectLocated(node ASTNode, elements []located, mode locateMode) (located, error) {
+	collected := []located{}
+	for _, element := range elements {
+		result, err := intr.locate(node, element, mode)
+		if err != nil {
+			return located{}, err
+		}
+		if result.value != nil || (mode != findValues && result.path != nil) {
+			collected = append(collected, result)
+		}
+	}
+	return projection(collected), nil
+}
+
+// walkError returns the error reported when Set or Update select a
+// location below current, which holds a value node can't be applied to:
+// a field of something else than an object, or an element of something
+// else than an array.  A missing value is only an error for an index,
+// since missing objects are created but missing arrays aren't.
+func walkError(node ASTNode, current located, mode locateMode) error {
+	if mode != createLocations || current.path == nil {
+		return nil
+	}
+	if current.value == nil {
+		if node.nodeType != ASTIndex {
+			return nil
+		}
+		return fmt.Errorf("jmespath: cannot select %s of the missing value at %s", describeNode(node), current.path)
+	}
+	return fmt.Errorf("jmespath: cannot select %s of the %s at %s", describeNode(node), describeValue(current.value), current.path)
+}
+
+func isStructType(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	return rv.Kind() == reflect.Struct
+}
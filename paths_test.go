@@ -0,0 +1,158 @@
+package jmespath
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/jmespath/go-jmespath/internal/testify/assert"
+)
+
+var pathsFixture = []byte(`{
+	"reservations": [
+		{"instances": [{"id": "i-1", "state": "running"}, {"id": "i-2", "state": "stopped"}]},
+		{"instances": [{"id": "i-3", "state": "running"}]}
+	],
+	"tags": {"env": "prod", "a/b": "slash"},
+	"nested": [[0, 1], [2, [3]], 4]
+}`)
+
+func pathResultStrings(results []PathResult) []string {
+	rendered := make([]string, len(results))
+	for i, result := range results {
+		rendered[i] = fmt.Sprintf("%s=%v", result.Path, result.Value)
+	}
+	return rendered
+}
+
+func TestSearchWithPaths(t *testing.T) {
+	assert := assert.New(t)
+	var data interface{}
+	assert.Nil(json.Unmarshal(pathsFixture, &data))
+	for expression, expected := range map[string][]string{
+		"reservations[0].instances[1].id":                  {"reservations[0].instances[1].id=i-2"},
+		"reservations[].instances[].id":                    {"reservations[0].instances[0].id=i-1", "reservations[0].instances[1].id=i-2", "reservations[1].instances[0].id=i-3"},
+		"reservations[*].instances[?state=='running'].id":  {"reservations[0].instances[0].id=i-1", "reservations[1].instances[0].id=i-3"},
+		"reservations[].instances[?state=='running'][].id": {"reservations[0].instances[0].id=i-1", "reservations[1].instances[0].id=i-3"},
+		"reservations[-1:].instances[0].state":             {"reservations[1].instances[0].state=running"},
+		"reservations[].instances[] | [1].id":              {"reservations[0].instances[1].id=i-2"},
+		"nested[]":                                         {"nested[0][0]=0", "nested[0][1]=1", "nested[1][0]=2", "nested[1][1]=[3]", "nested[2]=4"},
+		"nested[::-2]":                                     {"nested[2]=4", "nested[0]=[0 1]"},
+		"missing || tags.env":                              {"tags.env=prod"},
+		"tags.\"a/b\"":                                     {"tags.\"a/b\"=slash"},
+		"missing":                                          {},
+	} {
+		results, err := SearchWithPaths(expression, data)
+		assert.Nil(err, expression)
+		assert.Equal(expected, pathResultStrings(results), expression)
+	}
+}
+
+func TestSearchWithPathsComputedValues(t *testing.T) {
+	assert := assert.New(t)
+	var data interface{}
+	assert.Nil(json.Unmarshal(pathsFixture, &data))
+	// Computed values have no location, so they can't be mistaken for
+	// the document itself.
+	for _, expression := range []string{"length(reservations)", "[reservations[0].instances[0].id]", "{id: reservations[0].instances[0].id}"} {
+		results, err := SearchWithPaths(expression, data)
+		assert.Nil(err, expression)
+		assert.Empty(results, expression)
+	}
+	results, err := SearchWithPaths("@", data)
+	assert.Nil(err)
+	assert.Equal([]string{"@=" + fmt.Sprint(data)}, pathResultStrings(results))
+}
+
+func TestSearchWithPathsStrict(t *testing.T) {
+	assert := assert.New(t)
+	var data interface{}
+	assert.Nil(json.Unmarshal(pathsFixture, &data))
+	for _, expression := range []string{
+		"tags[0]",
+		"tags[1:]",
+		"tags[*].id",
+		"tags[?env]",
+		"tags[]",
+		"reservations.*",
+		"reservations.id",
+		"tags.env.name[]",
+		"reservations[?instances > `1`]",
+	} {
+		jp := MustCompile(expression)
+		jp.SetOptions(Options{Strict: true})
+		_, execErr := jp.Search(data)
+		_, err := jp.SearchWithPaths(data)
+		if assert.IsType(EvaluationError{}, err, expression) {
+			assert.Equal(execErr, err, expression)
+		}
+		jp.SetOptions(Options{})
+		results, err := jp.SearchWithPaths(data)
+		assert.Nil(err, expression)
+		assert.Empty(results, expression)
+	}
+}
+
+func TestSearchWithPathsObjectProjection(t *testing.T) {
+	assert := assert.New(t)
+	var data interface{}
+	assert.Nil(json.Unmarshal(pathsFixture, &data))
+	jp := MustCompile("tags.*")
+	jp.SetOptions(Options{SortKeys: true})
+	results, err := jp.SearchWithPaths(data)
+	assert.Nil(err)
+	assert.Equal([]string{`tags."a/b"=slash`, "tags.env=prod"}, pathResultStrings(results))
+	assert.Equal("/tags/a~1b", results[0].Path.JSONPointer())
+}
+
+func TestSearchWithPathsUserDefinedStructs(t *testing.T) {
+	assert := assert.New(t)
+	data := sliceType{A: "foo", B: []scalars{{"f1", "b1"}, {"correct", "b2"}}}
+	results, err := SearchWithPaths("B[?Bar=='b2'].Foo", data)
+	assert.Nil(err)
+	assert.Equal([]string{"B[1].Foo=correct"}, pathResultStrings(results))
+}
+
+func TestPathRendering(t *testing.T) {
+	assert := assert.New(t)
+	path := Path{"reservations", 0, "instances", 3, "my id", "~"}
+	assert.Equal(`reservations[0].instances[3]."my id"."~"`, path.String())
+	assert.Equal("/reservations/0/instances/3/my id/~0", path.JSONPointer())
+	assert.Equal("@", Path{}.String())
+	assert.Equal("", Path{}.JSONPointer())
+}
+
+// The values collected while locating must always be the same values
+// that Execute produces.
+func TestLocateAgreesWithExecute(t *testing.T) {
+	assert := assert.New(t)
+	intr := newInterpreter()
+	intr.opts.SortKeys = true
+	for _, filename := range whiteListed {
+		var testSuites []TestSuite
+		data, err := ioutil.ReadFile(filename)
+		if !assert.Nil(err) || !assert.Nil(json.Unmarshal(data, &testSuites)) {
+			continue
+		}
+		for _, suite := range testSuites {
+			for _, testcase := range suite.TestCases {
+				if testcase.Error != "" {
+					continue
+				}
+				ast, err := NewParser().Parse(testcase.Expression)
+				if !assert.Nil(err, testcase.Expression) {
+					continue
+				}
+				expected, err := intr.Execute(ast, suite.Given)
+				if err != nil {
+					continue
+				}
+				actual, err := intr.locate(ast, located{path: Path{}, value: suite.Given}, findValues)
+				if assert.Nil(err, testcase.Expression) {
+					assert.Equal(expected, actual.value, fmt.Sprintf("(%s) %s", filename, testcase.Expression))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package jmespath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semver is a semantic version as described by https://semver.org.
+type semver struct {
+	major, minor, patch uint64
+	prerelease          []string
+	build               string
+}
+
+// parseSemver parses a version such as "1.2.3", "v1.2.3-rc.1" or
+// "1.2.3+build.5".  A leading "v" is allowed.
+func parseSemver(s string) (semver, error) {
+	version, err := parsePartialSemver(s)
+	if err == nil && version.parts < 3 {
+		err = fmt.Errorf("invalid version %q", s)
+	}
+	return version.semver, err
+}
+
+// partialSemver is a version that may leave out the minor and patch
+// numbers, as the versions in constraints can.
+type partialSemver struct {
+	semver
+	parts int // number of version numbers given, from 0 ("*") to 3
+}
+
+// parsePartialSemver parses a version in which the minor and patch
+// numbers may be missing or wildcards ("x", "X" or "*"), such as "1.2" or
+// "1.x".
+func parsePartialSemver(s string) (partialSemver, error) {
+	var version partialSemver
+	original := s
+	invalid := fmt.Errorf("invalid version %q", original)
+	s = strings.TrimPrefix(s, "v")
+	numbers := []*uint64{&version.major, &version.minor, &version.patch}
+	for i, n := range numbers {
+		end := strings.IndexAny(s, ".-+")
+		if end < 0 {
+			end = len(s)
+		}
+		part := s[:end]
+		if part == "x" || part == "X" || part == "*" {
+			s = s[end:]
+			if i < 2 && strings.HasPrefix(s, ".") {
+				// Anything after a wildcard has to be a wildcard too.
+				rest, err := parsePartialSemver(s[1:])
+				if err != nil || rest.parts > 0 {
+					return version, invalid
+				}
+				s = ""
+			}
+			break
+		}
+		value, err := parseSemverNumber(part)
+		if err != nil {
+			return version, invalid
+		}
+		*n = value
+		version.parts++
+		s = s[end:]
+		if i == 2 || !strings.HasPrefix(s, ".") {
+			break
+		}
+		s = s[1:]
+	}
+	if version.parts == 3 && strings.HasPrefix(s, "-") {
+		end := strings.Index(s, "+")
+		if end < 0 {
+			end = len(s)
+		}
+		version.prerelease = strings.Split(s[1:end], ".")
+		for _, identifier := range version.prerelease {
+			if !isSemverIdentifier(identifier) {
+				return version, invalid
+			}
+			if isDigits(identifier) && len(identifier) > 1 && identifier[0] == '0' {
+				return version, invalid
+			}
+		}
+		s = s[end:]
+	}
+	if version.parts == 3 && strings.HasPrefix(s, "+") {
+		version.build = s[1:]
+		for _, identifier := range strings.Split(version.build, ".") {
+			if !isSemverIdentifier(identifier) {
+				return version, invalid
+			}
+		}
+		s = ""
+	}
+	if s != "" {
+		return version, invalid
+	}
+	return version, nil
+}
+
+func parseSemverNumber(s string) (uint64, error) {
+	if s == "" || !isDigits(s) || (len(s) > 1 && s[0] == '0') {
+		return 0, fmt.Errorf("invalid version number %q", s)
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isSemverIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func compareUint(a, b uint64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// compare returns -1, 0 or 1 depending on whether v has a lower, the same
+// or a higher precedence than other.  Build metadata is ignored.
+func (v semver) compare(other semver) int {
+	if c := compareUint(v.major, other.major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.minor, other.minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.patch, other.patch); c != 0 {
+		return c
+	}
+	// A pre-release version has a lower precedence than the release.
+	if len(v.prerelease) == 0 || len(other.prerelease) == 0 {
+		return compareUint(uint64(len(other.prerelease)), uint64(len(v.prerelease)))
+	}
+	for i := 0; i < len(v.prerelease) && i < len(other.prerelease); i++ {
+		a, b := v.prerelease[i], other.prerelease[i]
+		if a == b {
+			continue
+		}
+		aNumeric, bNumeric := isDigits(a), isDigits(b)
+		switch {
+		case aNumeric && bNumeric:
+			if len(a) != len(b) {
+				return compareUint(uint64(len(a)), uint64(len(b)))
+			}
+			return strings.Compare(a, b)
+		case aNumeric:
+			return -1
+		case bNumeric:
+			return 1
+		}
+		return strings.Compare(a, b)
+	}
+	return compareUint(uint64(len(v.prerelease)), uint64(len(other.prerelease)))
+}
+
+// key returns a string that sorts the same way as the version: strings
+// compare lexically, and version numbers are zero-padded so that "1.10.0"
+// sorts after "1.9.0".  A release sorts after its pre-releases because
+// "~" comes after "-", and the separators between pre-release identifiers
+// are chosen to sort before any character of an identifier.
+func (v semver) key() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%020d.%020d.%020d", v.major, v.minor, v.patch)
+	if len(v.prerelease) == 0 {
+		buf.WriteString("~")
+		return buf.String()
+	}
+	buf.WriteString("-")
+	for i, identifier := range v.prerelease {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		if isDigits(identifier) {
+			// Numeric identifiers sort before alphanumeric ones.
+			fmt.Fprintf(&buf, "0%020s", identifier)
+		} else {
+			buf.WriteString("1" + identifier)
+		}
+	}
+	buf.WriteString(" ")
+	return buf.String()
+}
+
+// satisfies reports whether v matches constraint, which is made of
+// comparisons separated by spaces, all of which have to match, and
+// alternatives separated by "||".  A comparison is a version preceded by
+// one of the operators =, !=, >, >=, <, <=, ~ or ^, and versions can
+// leave out numbers or use wildcards, for example ">=1.2 <2", "~1.4.2",
+// "^0.3" or "1.x || 2.x".  "~" allows patch updates and "^" allows
+// updates that don't change the leftmost non-zero number.
+func (v semver) satisfies(constraint string) (bool, error) {
+	// Every comparison is checked, even after a match, so that an invalid
+	// constraint is always reported.
+	satisfied := false
+	for _, alternative := range strings.Split(constraint, "||") {
+		fields := strings.Fields(alternative)
+		if len(fields) == 0 {
+			return false, fmt.Errorf("invalid constraint %q", constraint)
+		}
+		matched := true
+		for _, field := range fields {
+			ok, err := v.matches(field)
+			if err != nil {
+				return false, err
+			}
+			matched = matched && ok
+		}
+		satisfied = satisfied || matched
+	}
+	return satisfied, nil
+}
+
+// matches reports whether v matches a single comparison.
+func (v semver) matches(comparison string) (bool, error) {
+	op := ""
+	for _, candidate := range []string{">=", "<=", "!=", ">", "<", "=", "~", "^"} {
+		if strings.HasPrefix(comparison, candidate) {
+			op = candidate
+			break
+		}
+	}
+	bound, err := parsePartialSemver(comparison[len(op):])
+	if err != nil {
+		return false, fmt.Errorf("invalid constraint %q", comparison)
+	}
+	lower := bound.semver
+	lower.build = ""
+	c := v.compare(lower)
+	if bound.parts == 3 && op != "~" && op != "^" {
+		switch op {
+		case "", "=":
+			return c == 0, nil
+		case "!=":
+			return c != 0, nil
+		case ">":
+			return c > 0, nil
+		case ">=":
+			return c >= 0, nil
+		case "<":
+			return c < 0, nil
+		}
+		return c <= 0, nil
+	}
+	// Partial versions, "~" and "^" stand for a range of versions from
+	// lower up to, but not including, upper and its pre-releases.
+	var upper *semver
+	switch {
+	case bound.parts == 0:
+	case bound.parts == 1, op == "^" && bound.major > 0:
+		upper = &semver{major: bound.major + 1}
+	case bound.parts == 2, op == "~", op == "^" && bound.minor > 0:
+		upper = &semver{major: bound.major, minor: bound.minor + 1}
+	default:
+		upper = &semver{major: bound.major, minor: bound.minor, patch: bound.patch + 1}
+	}
+	belowUpper := upper == nil
+	if upper != nil {
+		upper.prerelease = []string{"0"}
+		belowUpper = v.compare(*upper) < 0
+	}
+	switch op {
+	case "", "=", "~", "^":
+		return c >= 0 && belowUpper, nil
+	case "!=":
+		return !(c >= 0 && belowUpper), nil
+	case ">":
+		return !belowUpper, nil
+	case ">=":
+		return c >= 0, nil
+	case "<":
+		return c < 0, nil
+	}
+	return belowUpper, nil
+}
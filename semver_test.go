@@ -0,0 +1,120 @@
+package jmespath
+
+import (
+	"testing"
+
+	"github.com/jmespath/go-jmespath/internal/testify/assert"
+)
+
+// Versions in increasing order of precedence, from the semver.org
+// specification plus a few that sort wrongly as strings.
+var orderedVersions = []string{
+	"0.9.0",
+	"1.0.0-alpha",
+	"1.0.0-alpha.1",
+	"1.0.0-alpha.beta",
+	"1.0.0-beta",
+	"1.0.0-beta.2",
+	"1.0.0-beta.11",
+	"1.0.0-rc.1",
+	"1.0.0",
+	"1.2.0",
+	"1.9.0",
+	"1.10.0-rc-1",
+	"1.10.0-rc-1.a",
+	"1.10.0",
+	"2.0.0",
+	"10.0.0",
+}
+
+func TestSemverPrecedence(t *testing.T) {
+	assert := assert.New(t)
+	for i, a := range orderedVersions {
+		for j, b := range orderedVersions {
+			va, err := parseSemver(a)
+			assert.Nil(err, a)
+			vb, err := parseSemver(b)
+			assert.Nil(err, b)
+			expected := compareUint(uint64(i), uint64(j))
+			assert.Equal(expected, va.compare(vb), "%s <=> %s", a, b)
+			keyOrder := 0
+			if va.key() < vb.key() {
+				keyOrder = -1
+			} else if va.key() > vb.key() {
+				keyOrder = 1
+			}
+			assert.Equal(expected, keyOrder, "key(%s) <=> key(%s)", a, b)
+		}
+	}
+}
+
+func TestParseSemver(t *testing.T) {
+	assert := assert.New(t)
+	v, err := parseSemver("v1.2.3-rc.1+build.5")
+	assert.Nil(err)
+	assert.Equal(semver{major: 1, minor: 2, patch: 3, prerelease: []string{"rc", "1"}, build: "build.5"}, v)
+	for _, invalid := range []string{"", "1", "1.2", "1.2.x", "01.2.3", "1.2.3-", "1.2.3-01", "1.2.3-a..b", "1.2.3+", "1.2.3.4", "1.2.3 ", "a.b.c"} {
+		_, err := parseSemver(invalid)
+		assert.NotNil(err, invalid)
+	}
+}
+
+func TestSemverSatisfies(t *testing.T) {
+	assert := assert.New(t)
+	cases := []struct {
+		version    string
+		constraint string
+		expected   bool
+	}{
+		{"1.2.3", "1.2.3", true},
+		{"1.2.3+build", "=1.2.3", true},
+		{"1.2.4", "1.2.3", false},
+		{"1.2.4", "!=1.2.3", true},
+		{"1.2.4", ">1.2.3", true},
+		{"1.2.3", ">1.2.3", false},
+		{"1.2.3", ">=1.2.3", true},
+		{"1.2.3-rc.1", "<1.2.3", true},
+		{"1.2.3", "<=1.2.3", true},
+		{"1.5.0", ">=1.2 <2", true},
+		{"2.0.0", ">=1.2 <2", false},
+		{"2.0.0-rc.1", "<2", true},
+		{"1.9.9", "<=1.9", true},
+		{"1.10.0", "<=1.9", false},
+		{"1.10.0", ">1.9", true},
+		{"1.9.5", ">1.9", false},
+		{"1.4.9", "~1.4.2", true},
+		{"1.5.0", "~1.4.2", false},
+		{"1.4.1", "~1.4.2", false},
+		{"1.9.0", "~1", true},
+		{"1.9.0", "^1.2.3", true},
+		{"2.0.0", "^1.2.3", false},
+		{"2.0.0-rc.1", "^1.2.3", false},
+		{"0.3.9", "^0.3", true},
+		{"0.4.0", "^0.3", false},
+		{"0.0.3", "^0.0.3", true},
+		{"0.0.4", "^0.0.3", false},
+		{"1.7.0", "1.x", true},
+		{"1.7.0", "1.7.*", true},
+		{"3.0.0", "1.x || 2.x", false},
+		{"2.1.0", "1.x || 2.x", true},
+		{"5.0.0", "*", true},
+		{"5.0.0", "", false},
+	}
+	for _, tt := range cases {
+		v, err := parseSemver(tt.version)
+		assert.Nil(err)
+		result, err := v.satisfies(tt.constraint)
+		if tt.constraint == "" {
+			assert.NotNil(err)
+			continue
+		}
+		if assert.Nil(err, tt.constraint) {
+			assert.Equal(tt.expected, result, "%s satisfies %q", tt.version, tt.constraint)
+		}
+	}
+	v, _ := parseSemver("1.0.0")
+	for _, invalid := range []string{">=a", "1.x.2", ">= 1.0", "1.0 ||", "~>1.0"} {
+		_, err := v.satisfies(invalid)
+		assert.NotNil(err, invalid)
+	}
+}
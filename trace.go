@@ -0,0 +1,140 @@
+package jmespath
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Tracer is notified as each part of an expression is evaluated, which
+// shows how an expression arrived at its result.  Enter is called with the
+// value a node of the expression is applied to, and Exit with the result
+// or error it produced.  Calls nest: the parts of a node, including the
+// expressions passed to functions such as sort_by(), are entered and
+// exited between the Enter and Exit calls of the node itself.
+//
+// A JMESPath calls its Tracer from every goroutine it is used in, so a
+// Tracer that is shared has to do its own locking.
+type Tracer interface {
+	Enter(node ASTNode, input interface{})
+	Exit(node ASTNode, output interface{}, err error)
+}
+
+// TreeTracer is a Tracer that records the evaluation of an expression and
+// renders it as an indented tree, with one line per evaluated node giving
+// the value it produced.  It is meant for a single evaluation at a time.
+type TreeTracer struct {
+	roots []*traceStep
+	stack []*traceStep
+}
+
+type traceStep struct {
+	node     ASTNode
+	output   interface{}
+	err      error
+	children []*traceStep
+}
+
+// NewTreeTracer creates a TreeTracer with nothing recorded.
+func NewTreeTracer() *TreeTracer {
+	return &TreeTracer{}
+}
+
+// Enter records the start of the evaluation of node.
+func (t *TreeTracer) Enter(node ASTNode, input interface{}) {
+	step := &traceStep{node: node}
+	if len(t.stack) == 0 {
+		t.roots = append(t.roots, step)
+	} else {
+		parent := t.stack[len(t.stack)-1]
+		parent.children = append(parent.children, step)
+	}
+	t.stack = append(t.stack, step)
+}
+
+// Exit records the result of the evaluation of node.
+func (t *TreeTracer) Exit(node ASTNode, output interface{}, err error) {
+	if len(t.stack) == 0 {
+		return
+	}
+	step := t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+	step.output = output
+	step.err = err
+}
+
+// Reset discards everything recorded so far.
+func (t *TreeTracer) Reset() {
+	t.roots = nil
+	t.stack = nil
+}
+
+// String renders the recorded evaluations, each node indented below the
+// node it is part of, for example:
+//
+//	Subexpression = "b"
+//	  Field "foo" = {"bar":"b"}
+//	  Field "bar" = "b"
+func (t *TreeTracer) String() string {
+	var buf strings.Builder
+	for _, root := range t.roots {
+		root.render(&buf, 0)
+	}
+	return buf.String()
+}
+
+func (s *traceStep) render(buf *strings.Builder, indent int) {
+	buf.WriteString(strings.Repeat("  ", indent))
+	buf.WriteString(traceLabel(s.node))
+	if s.err != nil {
+		buf.WriteString(" ! " + s.err.Error())
+	} else {
+		buf.WriteString(" = " + traceValue(s.output))
+	}
+	buf.WriteString("\n")
+	for _, child := range s.children {
+		child.render(buf, indent+1)
+	}
+}
+
+// traceLabel describes a node by its type and, for the nodes that have
+// one, the name, operator or literal value it was parsed from.
+func traceLabel(node ASTNode) string {
+	label := strings.TrimPrefix(node.nodeType.String(), "AST")
+	switch node.nodeType {
+	case ASTField, ASTKeyValPair:
+		return fmt.Sprintf("%s %q", label, node.value)
+	case ASTFunctionExpression:
+		return fmt.Sprintf("%s %s()", label, node.value)
+	case ASTComparator:
+		return label + " " + comparatorSymbols[node.value.(tokType)]
+	case ASTIndex:
+		return fmt.Sprintf("%s [%d]", label, node.value)
+	case ASTLiteral:
+		return label + " " + traceValue(node.value)
+	case ASTSlice:
+		parts := make([]string, 3)
+		for i, part := range node.value.([]*int) {
+			if part != nil {
+				parts[i] = fmt.Sprint(*part)
+			}
+		}
+		return fmt.Sprintf("%s [%s]", label, strings.Join(parts, ":"))
+	}
+	return label
+}
+
+// traceValue renders a value as compact JSON.
+func traceValue(value interface{}) string {
+	if ref, ok := value.(expRef); ok {
+		return "&" + traceLabel(ref.ref)
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,100 @@
+package jmespath
+
+import (
+	"testing"
+
+	"github.com/jmespath/go-jmespath/internal/testify/assert"
+)
+
+func TestTreeTracer(t *testing.T) {
+	assert := assert.New(t)
+	data := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "a", "price": 5.0},
+			map[string]interface{}{"name": "b", "price": "20"},
+		},
+	}
+	tracer := NewTreeTracer()
+	jp := MustCompile("items[?price > `1`].name | length(@)")
+	jp.SetOptions(Options{Tracer: tracer})
+	result, err := jp.Search(data)
+	assert.Nil(err)
+	assert.Equal(1.0, result)
+	expected := `Pipe = 1
+  FilterProjection = ["a"]
+    Field "items" = [{"name":"a","price":5},{"name":"b","price":"20"}]
+    Comparator > = true
+      Field "price" = 5
+      Literal 1 = 1
+    Field "name" = "a"
+    Comparator > = null
+      Field "price" = "20"
+      Literal 1 = 1
+  FunctionExpression length() = 1
+    CurrentNode = ["a"]
+`
+	assert.Equal(expected, tracer.String())
+
+	tracer.Reset()
+	assert.Equal("", tracer.String())
+	jp = MustCompile("items[0].name.first")
+	jp.SetOptions(Options{Tracer: tracer, Strict: true})
+	_, err = jp.Search(data)
+	assert.NotNil(err)
+	expected = `Subexpression ! EvaluationError: field "first" expects an object, received string
+  Subexpression = "a"
+    IndexExpression = {"name":"a","price":5}
+      Field "items" = [{"name":"a","price":5},{"name":"b","price":"20"}]
+      Index [0] = {"name":"a","price":5}
+    Field "name" = "a"
+  Field "first" ! EvaluationError: field "first" expects an object, received string
+`
+	assert.Equal(expected, tracer.String())
+}
+
+type countingTracer struct {
+	depth, maxDepth, calls int
+	inputs                 []interface{}
+}
+
+func (c *countingTracer) Enter(node ASTNode, input interface{}) {
+	c.depth++
+	c.calls++
+	if c.depth > c.maxDepth {
+		c.maxDepth = c.depth
+	}
+	if node.nodeType == ASTField {
+		c.inputs = append(c.inputs, input)
+	}
+}
+
+func (c *countingTracer) Exit(node ASTNode, output interface{}, err error) {
+	c.depth--
+}
+
+func TestTracerCallsAreNested(t *testing.T) {
+	assert := assert.New(t)
+	tracer := &countingTracer{}
+	jp := MustCompile("sort_by(people, &age)[].name")
+	jp.SetOptions(Options{Tracer: tracer})
+	data := map[string]interface{}{
+		"people": []interface{}{
+			map[string]interface{}{"name": "b", "age": 30.0},
+			map[string]interface{}{"name": "a", "age": 20.0},
+		},
+	}
+	result, err := jp.Search(data)
+	assert.Nil(err)
+	assert.Equal([]interface{}{"a", "b"}, result)
+	assert.Equal(0, tracer.depth)
+	assert.Equal(4, tracer.maxDepth)
+	// people, the age of each person inside sort_by() and then the name
+	// of each person in the projection.
+	assert.Equal([]interface{}{
+		data,
+		data["people"].([]interface{})[0],
+		data["people"].([]interface{})[1],
+		data["people"].([]interface{})[1],
+		data["people"].([]interface{})[0],
+	}, tracer.inputs)
+}
@@ -2,6 +2,7 @@ package jmespath
 
 import (
 	"errors"
+	"math"
 	"reflect"
 )
 
@@ -18,6 +19,8 @@ func isFalse(value interface{}) bool {
 		return len(v) == 0
 	case map[string]interface{}:
 		return len(v) == 0
+	case *OrderedMap:
+		return v.Len() == 0
 	case string:
 		return len(v) == 0
 	case nil:
@@ -46,8 +49,35 @@ func isFalse(value interface{}) bool {
 
 // ObjsEqual is a generic object equality check.
 // It will take two arbitrary objects and recursively determine
-// if they are equal.
+// if they are equal.  JSON objects are equal if they have the same
+// keys and values, regardless of key order or whether they are
+// represented as a map[string]interface{} or an *OrderedMap.
 func objsEqual(left interface{}, right interface{}) bool {
+	if isObject(left) && isObject(right) {
+		if objectLen(left) != objectLen(right) {
+			return false
+		}
+		for _, key := range objectKeys(left, false) {
+			rightValue, ok := objectLookup(right, key)
+			if !ok || !objsEqual(objectGet(left, key), rightValue) {
+				return false
+			}
+		}
+		return true
+	}
+	leftSlice, leftOk := left.([]interface{})
+	rightSlice, rightOk := right.([]interface{})
+	if leftOk && rightOk {
+		if len(leftSlice) != len(rightSlice) {
+			return false
+		}
+		for i := range leftSlice {
+			if !objsEqual(leftSlice[i], rightSlice[i]) {
+				return false
+			}
+		}
+		return true
+	}
 	return reflect.DeepEqual(left, right)
 }
 
@@ -61,22 +91,36 @@ type sliceParam struct {
 
 // Slice supports [start:stop:step] style slicing that's supported in JMESPath.
 func slice(slice []interface{}, parts []sliceParam) ([]interface{}, error) {
-	computed, err := computeSliceParams(len(slice), parts)
+	positions, err := slicePositions(len(slice), parts)
 	if err != nil {
 		return nil, err
 	}
-	start, stop, step := computed[0], computed[1], computed[2]
 	result := []interface{}{}
+	for _, i := range positions {
+		result = append(result, slice[i])
+	}
+	return result, nil
+}
+
+// slicePositions returns the positions a slice selects in an array of the
+// given length, in the order they are selected.
+func slicePositions(length int, parts []sliceParam) ([]int, error) {
+	computed, err := computeSliceParams(length, parts)
+	if err != nil {
+		return nil, err
+	}
+	start, stop, step := computed[0], computed[1], computed[2]
+	positions := []int{}
 	if step > 0 {
 		for i := start; i < stop; i += step {
-			result = append(result, slice[i])
+			positions = append(positions, i)
 		}
 	} else {
 		for i := start; i > stop; i += step {
-			result = append(result, slice[i])
+			positions = append(positions, i)
 		}
 	}
-	return result, nil
+	return positions, nil
 }
 
 func computeSliceParams(length int, parts []sliceParam) ([]int, error) {
@@ -88,6 +132,13 @@ func computeSliceParams(length int, parts []sliceParam) ([]int, error) {
 	} else {
 		step = parts[2].N
 	}
+	// A step longer than the array selects a single element, and capping
+	// it keeps the positions from overflowing.
+	if step > length+1 {
+		step = length + 1
+	} else if step < -(length + 1) {
+		step = -(length + 1)
+	}
 	var stepValueNegative bool
 	if step < 0 {
 		stepValueNegative = true
@@ -183,3 +234,109 @@ func isSliceType(v interface{}) bool {
 	}
 	return reflect.TypeOf(v).Kind() == reflect.Slice
 }
+
+// toInterfaceSlice returns the elements of a slice of any element type,
+// such as the []string field of a struct, as a []interface{}.
+func toInterfaceSlice(v interface{}) ([]interface{}, bool) {
+	if s, ok := v.([]interface{}); ok {
+		return s, true
+	}
+	if !isSliceType(v) {
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	result := make([]interface{}, rv.Len())
+	for i := range result {
+		result[i] = rv.Index(i).Interface()
+	}
+	return result, true
+}
+
+// maxInt and minInt are the limits of int, which the math package only
+// defines from Go 1.17 on.
+const (
+	maxInt = int(^uint(0) >> 1)
+	minInt = -maxInt - 1
+)
+
+// toInteger converts a number argument to an int, failing if the number
+// has a fractional part.  Numbers beyond the range of int are clamped to
+// it rather than converted to an arbitrary int: they are past either end
+// of any string or array all the same.
+func toInteger(arg interface{}) (int, error) {
+	n, ok := arg.(float64)
+	if !ok || n != math.Trunc(n) || math.IsInf(n, 0) {
+		return 0, errors.New("invalid value, expected an integer")
+	}
+	if n >= float64(maxInt) {
+		return maxInt, nil
+	}
+	if n <= float64(minInt) {
+		return minInt, nil
+	}
+	return int(n), nil
+}
+
+// jpTypeOf returns the JMESPath type name of value: "number", "string",
+// "boolean", "array", "object" or "null".  Besides the types encoding/json
+// decodes into, it classifies Go values by their kind, so that structs and
+// typed maps are objects, typed slices are arrays and every numeric type
+// is a number.  Pointers are classified by what they point to.
+func jpTypeOf(value interface{}) (string, bool) {
+	switch value.(type) {
+	case nil:
+		return "null", true
+	case bool:
+		return "boolean", true
+	case float64:
+		return "number", true
+	case string:
+		return "string", true
+	case []interface{}:
+		return "array", true
+	case map[string]interface{}, *OrderedMap:
+		return "object", true
+	}
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return "null", true
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Bool:
+		return "boolean", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number", true
+	case reflect.String:
+		return "string", true
+	case reflect.Slice, reflect.Array:
+		return "array", true
+	case reflect.Struct:
+		return "object", true
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			return "object", true
+		}
+	}
+	return "", false
+}
+
+// isOrdered reports whether two values whose comparison returned cmp
+// satisfy the ordering comparator op (<, <=, > or >=).
+func isOrdered(op tokType, cmp int) bool {
+	switch op {
+	case tGT:
+		return cmp > 0
+	case tGTE:
+		return cmp >= 0
+	case tLT:
+		return cmp < 0
+	case tLTE:
+		return cmp <= 0
+	}
+	return false
+}
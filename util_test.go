@@ -19,6 +19,35 @@ func TestSlicePositiveStep(t *testing.T) {
 	assert.Equal(input[:3], result)
 }
 
+func TestSliceHugeStep(t *testing.T) {
+	assert := assert.New(t)
+	input := []interface{}{0, 1, 2}
+	result, err := slice(input, []sliceParam{{1, true}, {3, true}, {maxInt, true}})
+	assert.Nil(err)
+	assert.Equal([]interface{}{1}, result)
+	result, err = slice(input, []sliceParam{{1, true}, {minInt, true}, {minInt, true}})
+	assert.Nil(err)
+	assert.Equal([]interface{}{1}, result)
+}
+
+func TestToIntegerClampsToIntRange(t *testing.T) {
+	assert := assert.New(t)
+	for arg, expected := range map[float64]int{
+		3:      3,
+		-3:     -3,
+		1e19:   maxInt,
+		-1e19:  minInt,
+		1e300:  maxInt,
+		-1e300: minInt,
+	} {
+		n, err := toInteger(arg)
+		assert.Nil(err)
+		assert.Equal(expected, n, "%v", arg)
+	}
+	_, err := toInteger(1.5)
+	assert.NotNil(err)
+}
+
 func TestIsFalseJSONTypes(t *testing.T) {
 	assert := assert.New(t)
 	assert.True(isFalse(false))